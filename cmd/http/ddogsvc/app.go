@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/collector"
 	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/implementation/datadog"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/sampling"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/validator"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/auth"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/limiter"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/ratelimit"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/shutdown"
 	api "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/web/api/ddogsvc"
 	handler "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/web/handler/ddogsvc"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/slo"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo"
 	"github.com/ariefaprilianto/ddog-experimental/lib/common/env"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/instance"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/validate"
+	"github.com/sirupsen/logrus"
 	_ "github.com/tokopedia/dexter/profx/integration"
 )
 
+// BuildInfoMetric is the gauge sent at startup, tagged with the build info and the container id
+const BuildInfoMetric = "build_info"
+
 func main() {
 	os.Exit(Main())
 }
@@ -22,34 +40,180 @@ func main() {
 // Main is the main function
 func Main() int {
 	// configuration init
-	cfg := getConfig()
+	cfg, err := getConfig()
+	if err != nil {
+		log.Println("failed to read config:", err)
+		return 1
+	}
+	if err := config.Validate(cfg); err != nil {
+		log.Println("invalid config:")
+		for _, fe := range err.(validate.Errors) {
+			log.Println(" -", fe.Error())
+		}
+		return 1
+	}
 
 	// cfg.Server.Name where you should put your custom service name here to distinguish stored ddog metric namespace
-	log.Printf("%s started,\n cfg=%+v", cfg.Server.Name, cfg) //message will not appear unless run with -debug switch
+	log.Printf("%s started, cfg:\n%s", cfg.Server.Name, config.Dump(cfg))
+
+	setLogLevel(cfg.Log.Level)
+
+	// instance metadata for metric tags and logs
+	meta := instance.Detect(&instance.Options{
+		IPPolicy: instance.PolicyByName(cfg.Instance.IPPolicy, cfg.Instance.Interface),
+	})
+	logrus.WithFields(meta.Fields()).Info("Instance detected")
 
 	// metric initialization
-	datadogClient := datadog.New(cfg.Server.Name, env.Get(), cfg.Datadog.Endpoint)
+	ddog := datadog.New(cfg.Server.Name, env.Get(), cfg.Datadog, meta)
+	datadogClient := validator.New(ddog)
+	// one point per start, so deployments show up on the dashboards
+	build := buildinfo.Get()
+	logrus.WithField("build", build).Info("Build info")
+	if err := datadogClient.Gauge(BuildInfoMetric, 1, append(build.Tags(), meta.InfoTags()...), 1); err != nil {
+		log.Println("failed to submit build info:", err)
+	}
+
+	sampler := sampling.NewFromConfig(cfg.Sampling, cfg.SamplingRule)
 	metric := &api.Metric{
 		DDogSvcMetric: datadogClient,
+		Sampler:       sampler,
 	}
 
+	// graceful shutdown, the hooks run in registration order once the requests are drained
+	shutdownCtl := shutdown.New(&shutdown.Options{
+		DrainDelay: time.Duration(cfg.Server.DrainDelay) * time.Second,
+	})
+
+	// runtime metric collector
+	if cfg.RuntimeMetric.Enabled {
+		runtimeCollector := collector.NewRuntime(datadogClient, &collector.Options{
+			Interval: time.Duration(cfg.RuntimeMetric.Interval) * time.Second,
+		})
+		runtimeCollector.Start()
+		shutdownCtl.OnShutdown("runtime metric", func(ctx context.Context) error {
+			runtimeCollector.Stop()
+			return nil
+		})
+	}
+
+	// slo tracking from the request outcomes
+	sloTracker := slo.NewFromConfig(datadogClient, cfg.SLO)
+	sloTracker.Start()
+	shutdownCtl.OnShutdown("slo", func(ctx context.Context) error {
+		sloTracker.Stop()
+		return nil
+	})
+
+	// concurrency limiting and load shedding
+	concurrencyLimiter := limiter.NewFromConfig(datadogClient, cfg.Limiter, cfg.RouteLimit)
+	concurrencyLimiter.Start()
+	shutdownCtl.OnShutdown("limiter", func(ctx context.Context) error {
+		concurrencyLimiter.Stop()
+		return nil
+	})
+
+	// authentication of the public routes
+	authGuard, err := auth.NewGuardFromConfig(cfg.Auth)
+	if err != nil {
+		log.Println("invalid auth config:", err)
+		return 1
+	}
+
+	// rate limiting per client, the buckets are kept in memory so the limits apply per instance
+	rateLimiter := ratelimit.NewFromConfig(datadogClient, cfg.RateLimit, ratelimit.NewMemoryStore(nil))
+
 	// init server
-	h := handler.Handler{Cfg: cfg, Metric: metric}
+	h := handler.Handler{
+		Cfg:         cfg,
+		Metric:      metric,
+		SLO:         sloTracker,
+		Shutdown:    shutdownCtl,
+		Auth:        authGuard,
+		Limiter:     concurrencyLimiter,
+		RateLimiter: rateLimiter,
+	}
 	server := handler.New(&h)
-	fmt.Println(fmt.Printf("%+v", h))
-	go server.Run()
+	fmt.Println(fmt.Printf("%+v", &h))
 
-	// catch terminal os signal
-	term := make(chan os.Signal)
+	// apply config changes without restart
+	if !cfg.Reload.Disabled {
+		reloader := config.NewReloader(cfg, &config.ReloaderOptions{
+			Module:   config.Module(),
+			Interval: time.Duration(cfg.Reload.Interval) * time.Second,
+			Metric:   datadogClient,
+		})
+		reloader.Subscribe(func(old, next *config.MainConfig) {
+			setLogLevel(next.Log.Level)
+			ddog.SetConfig(next.Datadog)
+			sampler.UpdateFromConfig(next.Sampling, next.SamplingRule)
+			server.ApplyConfig(next)
+		})
+		reloader.Start()
+		shutdownCtl.OnShutdown("config reload", func(ctx context.Context) error {
+			reloader.Stop()
+			return nil
+		})
+	}
+
+	// flush the buffered metrics and logs last so the shutdown itself is reported
+	shutdownCtl.OnShutdown("metrics", func(ctx context.Context) error {
+		return ddog.Close()
+	})
+	shutdownCtl.OnShutdown("logs", func(ctx context.Context) error {
+		// syncing a terminal or a pipe fails, only files on disk are buffered
+		f, ok := logrus.StandardLogger().Out.(*os.File)
+		if !ok {
+			return nil
+		}
+		if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		return f.Sync()
+	})
+
+	// start serving then catch terminal os signal, or a serving failure
+	exitCode := 0
+	term := make(chan os.Signal, 1)
 	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
-	select {
-	case s := <-term:
-		log.Println("Exiting gracefully...", s)
-	case err := <-server.ListenError():
+	if err := server.Start(); err != nil {
 		log.Println("Error starting web server, exiting gracefully:", err)
+		exitCode = 1
+	} else {
+		select {
+		case s := <-term:
+			log.Println("Exiting gracefully...", s)
+		case err := <-server.ListenError():
+			log.Println("Web server failed, exiting gracefully:", err)
+			exitCode = 1
+		}
+	}
+
+	timeout := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = shutdown.DefaultTimeout
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := shutdownCtl.Shutdown(ctx, server.Stop); err != nil {
+		log.Println("Shutdown did not complete:", err)
+		exitCode = 1
+	}
+
+	return exitCode
+}
 
-	return 0
+// setLogLevel sets the logrus level, the environment default when empty
+func setLogLevel(level string) {
+	if level == "" {
+		level = env.Current().LogLevel
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	logrus.SetLevel(lvl)
 }
 
 //EarlyExit from the app
@@ -60,8 +224,23 @@ func earlyExit(flag bool) {
 	}
 }
 
-func getConfig() *config.MainConfig {
+func getConfig() (*config.MainConfig, error) {
 	cfg := &config.MainConfig{}
-	config.ReadConfig(cfg, "main")
-	return cfg
+	config.BindFlags(flag.CommandLine, cfg)
+	dumpConfig := flag.Bool("dumpconfig", false, "print the effective config with the source of each value and exit")
+	flag.Parse()
+
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Load(cfg, config.Module()); err != nil {
+		return nil, err
+	}
+
+	if *dumpConfig {
+		fmt.Print(config.Dump(cfg))
+	}
+	earlyExit(*dumpConfig)
+
+	return cfg, nil
 }
@@ -4,81 +4,434 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/gcfg.v1"
 )
 
-// MainConfig is the main config file
+// MainConfig is the main config file, see Validate for the rules of the validate tags
 type MainConfig struct {
 	Server struct {
-		Name string
-		Port string
+		Name string `validate:"required"`
+		Port string `validate:"required,hostport"`
+		// ShutdownTimeout bounds the graceful shutdown, in seconds
+		ShutdownTimeout int `validate:"min=0"`
+		// DrainDelay is how long the readiness reports not ready before the listener closes on
+		// shutdown, in seconds, it counts in ShutdownTimeout
+		DrainDelay int `validate:"min=0"`
+		// http server tunables, zero means no limit or the net/http default
+		ReadTimeout       int `validate:"min=0"` // in seconds
+		ReadHeaderTimeout int `validate:"min=0"` // in seconds
+		WriteTimeout      int `validate:"min=0"` // in seconds
+		IdleTimeout       int `validate:"min=0"` // in seconds
+		MaxHeaderBytes    int `validate:"min=0"`
 	}
-	API     API
-	Datadog DatadogConfig
+	API           API
+	Admin         AdminConfig
+	Auth          AuthConfig
+	CORS          CORSConfig
+	Compression   CompressionConfig
+	TLS           TLSConfig
+	Datadog       DatadogConfig
+	RuntimeMetric RuntimeMetricConfig
+	Sampling      SamplingConfig
+	SamplingRule  map[string]*SamplingRuleConfig
+	SLO           map[string]*SLOConfig
+	Limiter       LimiterConfig
+	RouteLimit    map[string]*RouteLimitConfig
+	RateLimit     map[string]*RateLimitConfig
+	Log           LogConfig
+	Reload        ReloadConfig
+	Instance      InstanceConfig
 }
 
 type API struct {
-	NormalPrefix   string
-	DefaultTimeout int
+	NormalPrefix   string `validate:"startswith=/"`
+	DefaultTimeout int    `validate:"required,min=1,max=300"` // in seconds
+	// MaxBodySize limits the request bodies bound by the handlers, 1MB when zero
+	MaxBodySize int64 `validate:"min=0"` // in bytes
 }
 
+// AdminConfig enables the admin listener on Port, serving health, readiness, slo and
+// build info out of the public router. The config dump, fault controls, expvar and
+// pprof are served too when Debug is set or the environment defaults to the debug
+// endpoints, see env.Defaults, they are not authenticated. Without Port, only health
+// and readiness are served, by the public router.
+type AdminConfig struct {
+	Port  string `validate:"hostport"`
+	Debug bool
+}
+
+// AuthConfig enables authentication of the public routes, Methods are tried in order
+// among apikey, hmac and jwt. Exclude lists the registered paths, including
+// API.NormalPrefix, served without authentication.
+//
+// APIKeys are subject:key entries sent in APIKeyHeader, X-Api-Key by default.
+// HMACKeys are keyid:secret entries, see auth.HMAC for the signature, the signed
+// bodies are limited to HMACMaxBodySize, 1MB by default.
+// JWKSFile holds the keys verifying the HS and RS signed jwt, the tokens without exp
+// never expire unless JWTRequireExp is set.
+// The keys and secrets should reference secrets, e.g. subject:${env:API_KEY}.
+type AuthConfig struct {
+	Methods         []string
+	Exclude         []string
+	APIKeyHeader    string
+	APIKeys         []string
+	HMACKeys        []string
+	HMACMaxSkew     int   `validate:"min=0"` // in seconds
+	HMACMaxBodySize int64 `validate:"min=0"` // in bytes
+	JWKSFile        string
+	JWTIssuer       string
+	JWTAudience     string
+	JWTLeeway       int `validate:"min=0"` // in seconds
+	JWTRequireExp   bool
+}
+
+// CORSConfig allows cross-origin requests to the public routes when AllowedOrigins is set,
+// the preflight requests of the public routes are answered. An origin may hold one
+// * wildcard, e.g. https://*.example.com, and a single * allows any origin.
+// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE, a single * in
+// AllowedHeaders allows the headers asked by the preflight.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int `validate:"min=0"` // in seconds
+}
+
+// CompressionConfig compresses the public responses of at least MinSize bytes, 1024 when
+// zero, with the first of Encodings accepted by the client, br then gzip by default.
+// Level is the encoding level, zero uses the encoding default.
+type CompressionConfig struct {
+	Disabled  bool
+	Encodings []string
+	MinSize   int `validate:"min=0"` // in bytes
+	Level     int `validate:"min=0,max=11"`
+}
+
+// TLSConfig enables https when CertFile and KeyFile are set, the certificate is
+// reloaded when the files change. ClientAuth is none, request, require,
+// verify_if_given or verify, the last two check the client certificate against
+// ClientCAFile for mTLS. CipherSuites use the crypto/tls names. The tls settings are
+// rejected without CertFile.
+// HTTP/2 is negotiated over tls unless DisableHTTP2 is set, H2C enables it over plain http.
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	MinVersion     string `validate:"oneof=1.0 1.1 1.2 1.3"`
+	CipherSuites   []string
+	ClientAuth     string `validate:"oneof=none request require verify_if_given verify"`
+	ClientCAFile   string
+	ReloadInterval int `validate:"min=0"` // in seconds
+	DisableHTTP2   bool
+	H2C            bool
+}
+
+// DatadogConfig holds the dogstatsd client settings. Zero values fall back to
+// the client defaults.
+//
+// Transport is either "udp" (default, Endpoint is host:port) or "uds" (Endpoint
+// is the socket path, with or without the unix:// prefix). Origin detection over
+// UDS is done by the client itself from the DD_ENTITY_ID environment variable.
+//
+// Namespace defaults to enterprise_<Server.Name>. and Tags holds extra constant
+// key:value tags, one per line. DD_ENV, DD_SERVICE, DD_VERSION and DD_TAGS take
+// precedence over the values configured here.
 type DatadogConfig struct {
-	Endpoint string
+	Endpoint              string
+	Namespace             string
+	Version               string
+	Team                  string
+	Region                string
+	Tags                  []string
+	Transport             string `validate:"oneof=udp uds"`
+	MaxMessagesPerPayload int    `validate:"min=0"`
+	MaxBytesPerPayload    int    `validate:"min=0"`
+	BufferPoolSize        int    `validate:"min=0"`
+	BufferFlushInterval   int    `validate:"min=0"` // in milliseconds
+	SenderQueueSize       int    `validate:"min=0"`
+	WriteTimeoutUDS       int    `validate:"min=0"` // in milliseconds
+	ChannelMode           bool
+	ChannelModeBufferSize int `validate:"min=0"`
+	DisableTelemetry      bool
+}
+
+// RuntimeMetricConfig toggles the go runtime metric collector
+type RuntimeMetricConfig struct {
+	Enabled  bool
+	Interval int `validate:"min=0"` // in seconds
+}
+
+// SamplingConfig holds the default metric sample rate, the environment default when empty.
+// AlwaysSampleErrors keeps every request answered with ErrorStatus or above, 500 when
+// zero, e.g. 400 to keep the client errors too.
+type SamplingConfig struct {
+	DefaultRate        float64 `validate:"min=0,max=1"`
+	AlwaysSampleErrors bool
+	ErrorStatus        int `validate:"min=0,max=599"`
+}
+
+// SamplingRuleConfig is a named sampling rule, e.g. [SamplingRule "accounts"].
+// Metric and Route (the registered path including API.NormalPrefix) are matched
+// exactly, an empty value matches anything.
+// Type is either fixed (uses Rate) or adaptive (uses TargetPerSecond).
+type SamplingRuleConfig struct {
+	Metric          string
+	Route           string  `validate:"startswith=/"`
+	Type            string  `validate:"oneof=fixed adaptive"`
+	Rate            float64 `validate:"min=0,max=1"`
+	TargetPerSecond float64 `validate:"min=0"`
+}
+
+// SLOConfig is a named service level objective, e.g. [SLO "accounts"].
+// Availability and Latency are target percentages, a zero value disables the SLI.
+type SLOConfig struct {
+	Route            string  `validate:"required,startswith=/"`
+	Availability     float64 `validate:"min=0,max=100"`
+	Latency          float64 `validate:"min=0,max=100"`
+	LatencyThreshold int     `validate:"min=0"` // in milliseconds
+	Window           int     `validate:"min=0"` // in days
+}
+
+// LimiterConfig caps the concurrent in-flight handlers, a zero MaxInFlight means unlimited.
+// Up to MaxQueue requests over the limit wait QueueTimeout for a slot, the others are
+// shed with a 503 asking to retry after RetryAfter. MaxQueue defaults to the largest of
+// MaxInFlight and the RouteLimit values.
+type LimiterConfig struct {
+	MaxInFlight  int `validate:"min=0"`
+	MaxQueue     int `validate:"min=0"`
+	QueueTimeout int `validate:"min=0"` // in milliseconds
+	RetryAfter   int `validate:"min=0"` // in seconds
 }
 
+// RouteLimitConfig caps the in-flight handlers of a route, e.g. [RouteLimit "accounts"].
+// Route is the registered path including API.NormalPrefix.
+type RouteLimitConfig struct {
+	Route       string `validate:"required,startswith=/"`
+	MaxInFlight int    `validate:"required,min=1"`
+}
+
+// RateLimitConfig rate limits a group of routes per client, e.g. [RateLimit "public"].
+// Prefix matches the registered paths including API.NormalPrefix, the longest matching
+// prefix applies and an empty one matches every route. Key is ip, forwarded_ip, subject
+// or header:<Name>, e.g. header:X-Api-Key, which keys the requests sending the header by
+// their authenticated subject. Rate is in requests per second and Burst defaults to the
+// rate rounded up. The subject and header keys limit each client ip before authentication
+// too, with ClientRate and ClientBurst, Rate and Burst by default, they require
+// Auth.Methods.
+type RateLimitConfig struct {
+	Prefix      string `validate:"startswith=/"`
+	Key         string
+	Rate        float64 `validate:"required,min=0"`
+	Burst       int     `validate:"min=0"`
+	ClientRate  float64 `validate:"min=0"`
+	ClientBurst int     `validate:"min=0"`
+}
+
+// LogConfig sets the logrus level, the environment default when empty
+type LogConfig struct {
+	Level string `validate:"oneof=panic fatal error warn warning info debug trace"`
+}
+
+// ReloadConfig sets how often the config files are checked for changes, see Reloader
+type ReloadConfig struct {
+	Disabled bool
+	Interval int `validate:"min=0"` // in seconds
+}
+
+// InstanceConfig selects the primary ip reported in metric tags and logs.
+// Interface takes precedence over IPPolicy.
+type InstanceConfig struct {
+	IPPolicy  string `validate:"oneof=private public first"`
+	Interface string
+}
+
+// ReadConfig loads cfg in layers, each one overriding the values of the previous:
+//  1. <module>.<ext>, the base file shared by every environment
+//  2. <module>.<environment>.<ext>, the environment overlay
+//  3. environment variables <EnvPrefix>_<SECTION>_<KEY>, e.g. DDOGSVC_SERVER_PORT
+//  4. command line flags -<section>.<key>, e.g. -server.port, see BindFlags
+//
+// The files are looked up as described by Locate, rootServicePath forces the directory.
+// Files can be .ini, .yaml, .yml, .json or .toml, see RegisterDecoder for others.
+// String values may reference secrets as ${env:NAME} or ${file:/path}, they are
+// resolved once every layer is applied, see RegisterSecretProvider for others.
+// The source of every value is kept for Dump.
 func ReadConfig(cfg interface{}, module string, rootServicePath ...string) interface{} {
-	configPath := ""
-	dir, _ := os.Getwd()
+	if err := Load(cfg, module, rootServicePath...); err != nil {
+		log.Fatalln(err)
+	}
+	return cfg
+}
 
-	// added for common realize
+// Load reads cfg like ReadConfig but returns the error instead of exiting, the
+// sources and files of the previous load are kept when it fails
+func Load(cfg interface{}, module string, rootServicePath ...string) error {
+	l, err := loadLayers(cfg, module, rootServicePath...)
+	if err != nil {
+		return err
+	}
+	l.commit()
+	return nil
+}
+
+// loadLayers reads cfg like Load, the sources and files are only published once committed
+func loadLayers(cfg interface{}, module string, rootServicePath ...string) (*load, error) {
+	explicit := ""
 	if rootServicePath != nil {
-		dir = rootServicePath[0]
+		explicit = rootServicePath[0]
 	}
-	dirNames := strings.Split(dir, "/")
 
-	for _, dirName := range dirNames {
-		configPath += dirName + "/"
+	l := newLoad()
+
+	if err := l.readFiles(cfg, module, explicit); err != nil {
+		return nil, err
 	}
 
-	log.Println("configPath: ", configPath)
-	environ := os.Getenv("ENTENV")
-	if environ == "" {
-		environ = "development"
+	err := l.applyLayer(cfg, SourceEnv, func() error {
+		return readEnv(cfg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config from environment: %s", err)
 	}
 
-	configPath += ""
-	ok := ReadModuleConfig(cfg, configPath, module)
+	err = l.applyLayer(cfg, SourceFlag, func() error {
+		return readFlags(cfg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config from flags: %s", err)
+	}
+
+	if err := l.resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	normalize(cfg)
+
+	return l, nil
+}
+
+// normalize lowercases the enumerated values of MainConfig, they are validated against
+// lowercase values while the code using them ignores the case, e.g. Transport = UDS
+func normalize(cfg interface{}) {
+	c, ok := cfg.(*MainConfig)
 	if !ok {
-		log.Fatalf("failed to read config for module:%s at Path:%s for environ=%s\n", module, configPath, environ)
+		return
+	}
+	c.Datadog.Transport = strings.ToLower(c.Datadog.Transport)
+	c.TLS.ClientAuth = strings.ToLower(c.TLS.ClientAuth)
+	c.Log.Level = strings.ToLower(c.Log.Level)
+	c.Instance.IPPolicy = strings.ToLower(c.Instance.IPPolicy)
+	for _, rule := range c.SamplingRule {
+		rule.Type = strings.ToLower(rule.Type)
+	}
+	for i, method := range c.Auth.Methods {
+		c.Auth.Methods[i] = strings.ToLower(method)
+	}
+	for i, encoding := range c.Compression.Encodings {
+		c.Compression.Encodings[i] = strings.ToLower(encoding)
 	}
+}
 
-	return cfg
+// readFiles reads the explicit file, or the files of module found in the explicit or searched directories
+func (l *load) readFiles(cfg interface{}, module string, explicit string) error {
+	environ := Environment()
+	location, isFile := Locate(explicit)
+
+	if isFile {
+		ok, err := l.readFile(cfg, location[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("config file %s does not exist", location[0])
+		}
+		return nil
+	}
+
+	tried := []string{}
+	for _, dir := range location {
+		found, paths, err := l.readModuleConfig(cfg, dir, module, environ)
+		if err != nil {
+			return err
+		}
+		if found {
+			log.Println("configPath: ", dir)
+			return nil
+		}
+		tried = append(tried, paths...)
+	}
+
+	return fmt.Errorf("no config file found for module:%s environ=%s, tried:\n  %s", module, environ, strings.Join(tried, "\n  "))
 }
 
+// ReadModuleConfig reads the base and the environment config files of module, the base file is optional.
+// For each of them the first extension found, in the order of registration, is used.
 func ReadModuleConfig(cfg interface{}, path string, module string) bool {
-	environ := os.Getenv("ENTENV")
-	if environ == "" {
-		environ = "development"
+	l := newLoad()
+	found, _, err := l.readModuleConfig(cfg, path, module, Environment())
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if !found {
+		return false
+	}
+	l.commit()
+	return true
+}
+
+// readModuleConfig returns whether any file was found in dir and the paths it tried
+func (l *load) readModuleConfig(cfg interface{}, dir string, module string, environ string) (bool, []string, error) {
+	found := false
+	tried := []string{}
+	for _, name := range []string{module, module + "." + environ} {
+		for _, ext := range registeredExtensions() {
+			fname := filepath.Join(dir, name+ext)
+			tried = append(tried, fname)
+			ok, err := l.readFile(cfg, fname)
+			if err != nil {
+				return false, tried, err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
 	}
 
-	fname := path + "/" + module + "." + environ + ".ini"
+	return found, tried, nil
+}
 
-	fmt.Println("fname: ", fname)
+// readFile reads fname into cfg, it returns false without error when the file does not exist
+func (l *load) readFile(cfg interface{}, fname string) (bool, error) {
+	decode, ok := decoder(filepath.Ext(fname))
+	if !ok {
+		return false, fmt.Errorf("no decoder registered for %s", fname)
+	}
 
 	/* #nosec G304 */
 	config, err := ioutil.ReadFile(fname)
-	if err != nil {
-		log.Println(err)
-		return false
+	if os.IsNotExist(err) {
+		return false, nil
 	}
-	err = gcfg.FatalOnly(gcfg.ReadStringInto(cfg, string(config)))
 	if err != nil {
-		log.Println(err)
-		return false
+		return false, err
 	}
 
-	return true
+	log.WithField("File", fname).Debug("Reading config file")
+	l.files = append(l.files, fname)
+
+	err = l.applyLayer(cfg, fname, func() error {
+		if err := resetSlices(cfg, config, decode); err != nil {
+			return err
+		}
+		return decode(config, cfg)
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", fname, err)
+	}
+	return true, nil
 }
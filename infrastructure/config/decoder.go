@@ -0,0 +1,255 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/gcfg.v1"
+	"gopkg.in/yaml.v2"
+)
+
+// Decoder decodes the content of a config file into cfg
+type Decoder func(data []byte, cfg interface{}) error
+
+var (
+	// extensions are tried in order when looking for a config file
+	extensions = []string{".ini", ".yaml", ".yml", ".json", ".toml"}
+	decoders   = map[string]Decoder{
+		".ini":  DecodeINI,
+		".yaml": DecodeYAML,
+		".yml":  DecodeYAML,
+		".json": DecodeJSON,
+		".toml": DecodeTOML,
+	}
+)
+
+// RegisterDecoder makes ReadConfig look for files with ext, e.g. ".hcl", decoded by d
+func RegisterDecoder(ext string, d Decoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := decoders[ext]; !ok {
+		extensions = append(extensions, ext)
+	}
+	decoders[ext] = d
+}
+
+func decoder(ext string) (Decoder, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	d, ok := decoders[ext]
+	return d, ok
+}
+
+func registeredExtensions() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string{}, extensions...)
+}
+
+// DecodeINI decodes gcfg INI files
+func DecodeINI(data []byte, cfg interface{}) error {
+	return gcfg.FatalOnly(gcfg.ReadStringInto(cfg, string(data)))
+}
+
+// DecodeJSON decodes JSON files, keys match the field names case insensitively like gcfg
+func DecodeJSON(data []byte, cfg interface{}) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	return decodeGeneric(raw, cfg)
+}
+
+// DecodeYAML decodes YAML files with the same key matching as DecodeJSON
+func DecodeYAML(data []byte, cfg interface{}) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	normalized, err := stringKeys(raw)
+	if err != nil {
+		return err
+	}
+	return decodeGeneric(normalized, cfg)
+}
+
+// DecodeTOML decodes TOML files with the same key matching as DecodeJSON
+func DecodeTOML(data []byte, cfg interface{}) error {
+	raw := map[string]interface{}{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return err
+	}
+	return decodeGeneric(raw, cfg)
+}
+
+// decodeGeneric maps generic values onto cfg through JSON so every format shares the same field
+// matching. The named subsections, e.g. SLO.accounts, are decoded into their existing entries so
+// a file overrides their values one by one, like gcfg does, instead of replacing them. The
+// numbers and booleans set to string fields are converted like gcfg does, e.g. Port: 9000.
+func decodeGeneric(raw interface{}, cfg interface{}) error {
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	raw = coerce(raw, root.Type())
+	sections, ok := raw.(map[string]interface{})
+	if ok && root.Kind() == reflect.Struct {
+		rest := make(map[string]interface{}, len(sections))
+		for name, value := range sections {
+			field, found := fieldByNameFold(root, name)
+			subsections, isMap := value.(map[string]interface{})
+			if !found || !isMap || !isSubsectionMap(field.Type()) {
+				rest[name] = value
+				continue
+			}
+			if err := mergeSubsections(name, field, subsections); err != nil {
+				return err
+			}
+		}
+		raw = rest
+	}
+
+	return remarshal("", raw, cfg)
+}
+
+// remarshal decodes v, the value of the config key path, into dst through JSON. The errors
+// name the config key as written in the file, e.g. "server.shutdowntimeout: cannot use a string as int".
+func remarshal(path string, v interface{}, dst interface{}) error {
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, dst)
+	}
+	if err == nil {
+		return nil
+	}
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		key := typeErr.Field
+		if path != "" && key != "" {
+			key = path + "." + key
+		} else if path != "" {
+			key = path
+		}
+		want := typeErr.Type.String()
+		if typeErr.Type.Kind() == reflect.Struct || typeErr.Type.Kind() == reflect.Map {
+			want = "section"
+		}
+		return fmt.Errorf("%s: cannot use a %s as %s", key, typeErr.Value, want)
+	}
+	if path != "" {
+		return fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// coerce converts the numbers and booleans of raw set to string fields of t into strings
+func coerce(raw interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		switch v := raw.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool, int, int64, uint64:
+			return fmt.Sprint(v)
+		}
+	case reflect.Slice:
+		if items, ok := raw.([]interface{}); ok {
+			for i, item := range items {
+				items[i] = coerce(item, t.Elem())
+			}
+		}
+	case reflect.Map:
+		if m, ok := raw.(map[string]interface{}); ok {
+			for k, v := range m {
+				m[k] = coerce(v, t.Elem())
+			}
+		}
+	case reflect.Struct:
+		if m, ok := raw.(map[string]interface{}); ok {
+			for k, v := range m {
+				if f, found := structFieldFold(t, k); found {
+					m[k] = coerce(v, f.Type)
+				}
+			}
+		}
+	}
+	return raw
+}
+
+// mergeSubsections decodes each subsection of the section into the entry of field with the same name
+func mergeSubsections(section string, field reflect.Value, subsections map[string]interface{}) error {
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+	for name, value := range subsections {
+		key := reflect.ValueOf(name).Convert(field.Type().Key())
+		entry := field.MapIndex(key)
+		if !entry.IsValid() || entry.IsNil() {
+			entry = reflect.New(field.Type().Elem().Elem())
+		}
+		if err := remarshal(section+"."+name, value, entry.Interface()); err != nil {
+			return err
+		}
+		field.SetMapIndex(key, entry)
+	}
+	return nil
+}
+
+// isSubsectionMap tells whether t holds named subsections, i.e. is a map of struct pointers
+func isSubsectionMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String &&
+		t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct
+}
+
+// fieldByNameFold returns the field of v named name, case insensitively like encoding/json
+func fieldByNameFold(v reflect.Value, name string) (reflect.Value, bool) {
+	f, found := structFieldFold(v.Type(), name)
+	if !found {
+		return reflect.Value{}, false
+	}
+	return v.FieldByIndex(f.Index), true
+}
+
+// structFieldFold returns the field of t named name, case insensitively
+func structFieldFold(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// stringKeys converts the map[interface{}]interface{} produced by yaml into JSON encodable maps
+func stringKeys(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported yaml key %v", k)
+			}
+			converted, err := stringKeys(val)
+			if err != nil {
+				return nil, err
+			}
+			m[strings.TrimSpace(key)] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i, val := range t {
+			converted, err := stringKeys(val)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = converted
+		}
+		return t, nil
+	}
+	return v, nil
+}
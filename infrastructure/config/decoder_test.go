@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode Decoder
+		data   string
+	}{
+		{"ini", DecodeINI, `
+[Server]
+  Port = 9000
+[Datadog]
+  Tags = tier:backend
+  Tags = 8125
+[SLO "accounts"]
+  Route = /accounts
+  LatencyThreshold = 250
+`},
+		{"yaml", DecodeYAML, `
+server:
+  port: 9000
+datadog:
+  tags: [tier:backend, 8125]
+slo:
+  accounts:
+    route: /accounts
+    latencythreshold: 250
+`},
+		{"json", DecodeJSON, `{
+  "Server": {"Port": 9000},
+  "Datadog": {"Tags": ["tier:backend", 8125]},
+  "SLO": {"accounts": {"Route": "/accounts", "LatencyThreshold": 250}}
+}`},
+		{"toml", DecodeTOML, `
+[Server]
+Port = 9000
+[Datadog]
+Tags = ["tier:backend", "8125"]
+[SLO.accounts]
+Route = "/accounts"
+LatencyThreshold = 250
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &MainConfig{}
+			if err := tt.decode([]byte(tt.data), cfg); err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			if cfg.Server.Port != "9000" {
+				t.Errorf("Server.Port = %q, want 9000", cfg.Server.Port)
+			}
+			if strings.Join(cfg.Datadog.Tags, ",") != "tier:backend,8125" {
+				t.Errorf("Datadog.Tags = %v, want tier:backend and 8125", cfg.Datadog.Tags)
+			}
+			slo := cfg.SLO["accounts"]
+			if slo == nil || slo.Route != "/accounts" || slo.LatencyThreshold != 250 {
+				t.Errorf("SLO.accounts = %+v, want /accounts within 250ms", slo)
+			}
+		})
+	}
+}
+
+func TestDecodeGenericMergesSubsections(t *testing.T) {
+	cfg := &MainConfig{SLO: map[string]*SLOConfig{"accounts": {Route: "/accounts", Availability: 99.9}}}
+	if err := DecodeYAML([]byte("slo:\n  accounts:\n    latency: 99\n"), cfg); err != nil {
+		t.Fatalf("DecodeYAML() error = %v", err)
+	}
+	if slo := cfg.SLO["accounts"]; slo.Route != "/accounts" || slo.Availability != 99.9 || slo.Latency != 99 {
+		t.Errorf("SLO.accounts = %+v, want the values of both layers", slo)
+	}
+}
+
+func TestDecodeGenericErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		decode  Decoder
+		data    string
+		wantErr string
+	}{
+		{"yaml", DecodeYAML, "server:\n  shutdowntimeout: soon\n", "server.shutdowntimeout: cannot use a string as int"},
+		{"toml", DecodeTOML, "[Datadog]\nChannelMode = \"yes\"\n", "Datadog.ChannelMode: cannot use a string as bool"},
+		{"json subsection", DecodeJSON, `{"SLO": {"accounts": {"Latency": "high"}}}`, "SLO.accounts.Latency: cannot use a string as float64"},
+		{"yaml section", DecodeYAML, "server: 9000\n", "server: cannot use a number as section"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.decode([]byte(tt.data), &MainConfig{})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("decode() error = %v, want %s", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "json") {
+				t.Errorf("decode() error = %v, leaks the json round trip", err)
+			}
+		})
+	}
+}
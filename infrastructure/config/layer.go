@@ -0,0 +1,326 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EnvPrefix prefixes the environment variables overriding config values
+var EnvPrefix = "DDOGSVC"
+
+// Sources of a config value other than the file names
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+var (
+	mu         sync.Mutex
+	sources    = map[string]string{}
+	secrets    = map[string]bool{}
+	files      = []string{}
+	flagValues = map[string]string{}
+)
+
+// load collects the sources and files of one load, they are published by commit once it succeeded
+type load struct {
+	sources map[string]string
+	secrets map[string]bool
+	files   []string
+}
+
+func newLoad() *load {
+	return &load{
+		sources: map[string]string{},
+		secrets: map[string]bool{},
+	}
+}
+
+func (l *load) commit() {
+	mu.Lock()
+	defer mu.Unlock()
+	sources = l.sources
+	secrets = l.secrets
+	files = l.files
+}
+
+// flagValue records the raw value of a config flag, it is applied by ReadConfig
+type flagValue string
+
+func (f flagValue) String() string {
+	return ""
+}
+
+func (f flagValue) Set(value string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	flagValues[string(f)] = value
+	return nil
+}
+
+// BindFlags registers -config, -env and a -<section>.<key> flag on fs for every value
+// of the cfg sections. It must be called before fs is parsed and before ReadConfig.
+// Named subsections, e.g. [SLO "accounts"], can only be set from files.
+func BindFlags(fs *flag.FlagSet, cfg interface{}) {
+	bindLocationFlags(fs)
+	for _, key := range settableKeys(cfg) {
+		fs.Var(flagValue(key), strings.ToLower(key), fmt.Sprintf("override %s config value", key))
+	}
+}
+
+// Sources returns the layer each config value was last set by, keyed by Section.Key
+func Sources() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+	s := make(map[string]string, len(sources))
+	for k, v := range sources {
+		s[k] = v
+	}
+	return s
+}
+
+// Dump returns the effective config, one "Section.Key = value (source)" per line.
+// Values resolved from secret references are masked.
+func Dump(cfg interface{}) string {
+	values := flatten(cfg)
+	src := Sources()
+
+	mu.Lock()
+	for k := range secrets {
+		if _, ok := values[k]; ok {
+			values[k] = SecretMask
+		}
+	}
+	mu.Unlock()
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		source, ok := src[k]
+		if !ok {
+			source = SourceDefault
+		}
+		fmt.Fprintf(&b, "%s = %s (%s)\n", k, values[k], source)
+	}
+	return b.String()
+}
+
+// Files returns the config files read by the last successful load
+func Files() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string{}, files...)
+}
+
+// applyLayer runs apply and records source for every value it changed
+func (l *load) applyLayer(cfg interface{}, source string, apply func() error) error {
+	before := flatten(cfg)
+	if err := apply(); err != nil {
+		return err
+	}
+
+	for k, v := range flatten(cfg) {
+		if before[k] != v {
+			l.sources[k] = source
+		}
+	}
+	return nil
+}
+
+// resetSlices empties the slice values of cfg set by data, so the multi-valued keys of a
+// layer, e.g. Datadog.Tags, replace the values of the previous layers instead of being
+// appended to them as gcfg does when decoding into the same struct
+func resetSlices(cfg interface{}, data []byte, decode Decoder) error {
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	if root.Kind() != reflect.Struct {
+		return nil
+	}
+	layer := reflect.New(root.Type())
+	if err := decode(data, layer.Interface()); err != nil {
+		return err
+	}
+	resetSetSlices(root, layer.Elem())
+	return nil
+}
+
+// resetSetSlices empties the slices of dst which are not empty in layer, through structs and named subsections
+func resetSetSlices(dst, layer reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			if dst.Type().Field(i).PkgPath == "" {
+				resetSetSlices(dst.Field(i), layer.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if layer.Len() > 0 {
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+	case reflect.Map:
+		for _, name := range layer.MapKeys() {
+			entry := dst.MapIndex(name)
+			if entry.IsValid() && entry.Kind() == reflect.Ptr && !entry.IsNil() {
+				resetSetSlices(entry.Elem(), reflect.Indirect(layer.MapIndex(name)))
+			}
+		}
+	}
+}
+
+// readEnv sets every value that has a matching environment variable
+func readEnv(cfg interface{}) error {
+	for _, key := range settableKeys(cfg) {
+		name := EnvPrefix + "_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+		if raw, ok := os.LookupEnv(name); ok {
+			if err := setValue(cfg, key, raw); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readFlags sets every value given as flag
+func readFlags(cfg interface{}) error {
+	mu.Lock()
+	values := make(map[string]string, len(flagValues))
+	for k, v := range flagValues {
+		values[k] = v
+	}
+	mu.Unlock()
+
+	for key, raw := range values {
+		if err := setValue(cfg, key, raw); err != nil {
+			return fmt.Errorf("-%s: %s", strings.ToLower(key), err)
+		}
+	}
+	return nil
+}
+
+// flatten returns every config value keyed by Section.Key, or Section.name.Key for named subsections
+func flatten(cfg interface{}) map[string]string {
+	values := map[string]string{}
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	if root.Kind() != reflect.Struct {
+		return values
+	}
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i).Name
+		v := root.Field(i)
+		switch v.Kind() {
+		case reflect.Struct:
+			flattenStruct(values, section, v)
+		case reflect.Map:
+			for _, name := range v.MapKeys() {
+				sub := reflect.Indirect(v.MapIndex(name))
+				if sub.Kind() == reflect.Struct {
+					flattenStruct(values, section+"."+name.String(), sub)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func flattenStruct(values map[string]string, prefix string, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		values[prefix+"."+v.Type().Field(i).Name] = fmt.Sprint(v.Field(i).Interface())
+	}
+}
+
+// settableKeys lists the Section.Key of every value that can be overridden by env or flag
+func settableKeys(cfg interface{}) []string {
+	keys := []string{}
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	if root.Kind() != reflect.Struct {
+		return keys
+	}
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			if field.PkgPath == "" && isSettable(field.Type) {
+				keys = append(keys, root.Type().Field(i).Name+"."+field.Name)
+			}
+		}
+	}
+	return keys
+}
+
+func isSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// setValue parses raw into the value at Section.Key, slices are comma separated
+func setValue(cfg interface{}, key string, raw string) error {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid config key %q", key)
+	}
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	section := root.FieldByName(parts[0])
+	if section.Kind() != reflect.Struct {
+		return fmt.Errorf("unknown config section %q", parts[0])
+	}
+	field := section.FieldByName(parts[1])
+	if !field.IsValid() || !field.CanSet() {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		values := []string{}
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s of config key %q", field.Type(), key)
+	}
+	return nil
+}
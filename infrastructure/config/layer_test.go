@@ -0,0 +1,193 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/env"
+)
+
+// configDir writes files, name to content, into a temporary directory removed by the returned func
+func configDir(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		writeConfig(t, dir, name, content)
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func writeConfig(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setEnv sets the environment variable name until the returned func is called
+func setEnv(name, value string) func() {
+	os.Setenv(name, value)
+	return func() {
+		os.Unsetenv(name)
+	}
+}
+
+// setFlag sets the config flag of key as if parsed until the returned func is called
+func setFlag(key, value string) func() {
+	flagValue(key).Set(value)
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(flagValues, key)
+	}
+}
+
+const baseINI = `
+[Server]
+Name = base
+Port = :9000
+[API]
+DefaultTimeout = 10
+[Datadog]
+Endpoint = localhost:8125
+Version = base
+Team = base
+Region = base
+Tags = tier:base
+Tags = zone:a
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	if err := env.Set(env.EnvDevelopment); err != nil {
+		t.Fatal(err)
+	}
+	dir, cleanup := configDir(t, map[string]string{
+		"main.ini": baseINI,
+		"main.development.yaml": `
+server:
+  port: 9001
+datadog:
+  team: overlay
+  region: overlay
+  tags: [tier:overlay]
+`,
+	})
+	defer cleanup()
+	defer setEnv("DDOGSVC_DATADOG_REGION", "env")()
+	defer setEnv("DDOGSVC_SERVER_PORT", ":9002")()
+	defer setFlag("Server.Port", ":9003")()
+
+	cfg := &MainConfig{}
+	if err := Load(cfg, "main", dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	base, overlay := filepath.Join(dir, "main.ini"), filepath.Join(dir, "main.development.yaml")
+	tests := []struct {
+		key        string
+		got        string
+		want       string
+		wantSource string
+	}{
+		{"Server.Name", cfg.Server.Name, "base", base},
+		{"Datadog.Version", cfg.Datadog.Version, "base", base},
+		{"Datadog.Team", cfg.Datadog.Team, "overlay", overlay},
+		// the slices of a layer replace the previous values
+		{"Datadog.Tags", strings.Join(cfg.Datadog.Tags, ","), "tier:overlay", overlay},
+		{"Datadog.Region", cfg.Datadog.Region, "env", SourceEnv},
+		{"Server.Port", cfg.Server.Port, ":9003", SourceFlag},
+	}
+	sources := Sources()
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.key, tt.got, tt.want)
+			}
+			if sources[tt.key] != tt.wantSource {
+				t.Errorf("source of %s = %q, want %q", tt.key, sources[tt.key], tt.wantSource)
+			}
+		})
+	}
+	if files := Files(); len(files) != 2 || files[0] != base || files[1] != overlay {
+		t.Errorf("Files() = %v, want the base then the overlay", files)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, cleanup := configDir(t, map[string]string{"main.ini": baseINI})
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		env     string
+		flag    string
+		wantErr string
+	}{
+		{"env", "DDOGSVC_API_DEFAULTTIMEOUT", "", "failed to read config from environment: DDOGSVC_API_DEFAULTTIMEOUT: "},
+		{"flag", "", "API.DefaultTimeout", "failed to read config from flags: -api.defaulttimeout: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				defer setEnv(tt.env, "ten")()
+			}
+			if tt.flag != "" {
+				defer setFlag(tt.flag, "ten")()
+			}
+			err := Load(&MainConfig{}, "main", dir)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	missing, cleanupMissing := configDir(t, nil)
+	defer cleanupMissing()
+	if err := Load(&MainConfig{}, "main", missing); err == nil || !strings.HasPrefix(err.Error(), "no config file found for module:main") {
+		t.Errorf("Load() error = %v, want no config file found", err)
+	}
+}
+
+func TestDumpMasksSecrets(t *testing.T) {
+	dir, cleanup := configDir(t, map[string]string{
+		"main.ini": baseINI + `
+[Auth]
+Methods = apikey
+APIKeys = svc:${env:CONFIG_TEST_API_KEY}
+`,
+	})
+	defer cleanup()
+	defer setEnv("CONFIG_TEST_API_KEY", "s3cret")()
+
+	cfg := &MainConfig{}
+	if err := Load(cfg, "main", dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Auth.APIKeys) != 1 || cfg.Auth.APIKeys[0] != "svc:s3cret" {
+		t.Fatalf("Auth.APIKeys = %v, want the resolved secret", cfg.Auth.APIKeys)
+	}
+
+	dump := Dump(cfg)
+	if strings.Contains(dump, "s3cret") {
+		t.Errorf("Dump() leaks the secret:\n%s", dump)
+	}
+	base := filepath.Join(dir, "main.ini")
+	for _, want := range []string{
+		"Auth.APIKeys = " + SecretMask + " (" + base + ")\n",
+		"Auth.Methods = [apikey] (" + base + ")\n",
+		"Server.Name = base (" + base + ")\n",
+		"Server.ShutdownTimeout = 0 (" + SourceDefault + ")\n",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Dump() does not hold %q:\n%s", want, dump)
+		}
+	}
+}
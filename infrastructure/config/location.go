@@ -0,0 +1,85 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/env"
+)
+
+// DefaultModule is the name of the config files when neither -module nor <EnvPrefix>_CONFIG_MODULE is set
+const DefaultModule = "main"
+
+var (
+	configFlag string
+	moduleFlag string
+)
+
+// envValue selects the environment in the env registry, rejecting unknown ones
+type envValue struct{}
+
+func (envValue) String() string {
+	return ""
+}
+
+func (envValue) Set(name string) error {
+	return env.Set(name)
+}
+
+// bindLocationFlags registers -config, -module and -env on fs
+func bindLocationFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFlag, "config", "", "config file, or directory holding the config files, overrides "+EnvPrefix+"_CONFIG")
+	fs.StringVar(&moduleFlag, "module", "", "name of the config files, <module>.<env>.ini, overrides "+EnvPrefix+"_CONFIG_MODULE")
+	fs.Var(envValue{}, "env", "environment of the config overlay, overrides "+env.EnvVar)
+}
+
+// Module returns the name of the config files: the -module flag, else the
+// <EnvPrefix>_CONFIG_MODULE environment variable, else DefaultModule
+func Module() string {
+	for _, m := range []string{moduleFlag, os.Getenv(EnvPrefix + "_CONFIG_MODULE")} {
+		if m != "" {
+			return m
+		}
+	}
+	return DefaultModule
+}
+
+// Environment returns the environment of the config overlay, see env.Current
+func Environment() string {
+	return env.Get()
+}
+
+// Locate returns where to look for the config files, in order of precedence:
+//  1. explicit, when not empty
+//  2. the -config flag
+//  3. the <EnvPrefix>_CONFIG environment variable
+//  4. the directories of <EnvPrefix>_CONFIG_PATH, separated by the os path list separator
+//  5. the working directory, the directory of the executable, then /etc/<envprefix>
+//
+// The first three may be a file, in which case it is returned alone with isFile true.
+func Locate(explicit string) (paths []string, isFile bool) {
+	for _, p := range []string{explicit, configFlag, os.Getenv(EnvPrefix + "_CONFIG")} {
+		if p == "" {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return []string{p}, false
+		}
+		return []string{p}, true
+	}
+
+	if list := os.Getenv(EnvPrefix + "_CONFIG_PATH"); list != "" {
+		return filepath.SplitList(list), false
+	}
+
+	paths = []string{}
+	if wd, err := os.Getwd(); err == nil {
+		paths = append(paths, wd)
+	}
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Dir(exe))
+	}
+	return append(paths, filepath.Join("/etc", strings.ToLower(EnvPrefix))), false
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultReloadInterval is used when the configured interval is not positive
+const DefaultReloadInterval = 5 * time.Second
+
+// ReloadMetric counts the reloads, tagged with status:success or status:failed
+const ReloadMetric = "config.reload"
+
+// ReloaderOptions holds the reloader settings
+type ReloaderOptions struct {
+	Module          string
+	RootServicePath []string
+	Interval        time.Duration
+	Metric          metric.MetricInterface
+}
+
+// Reloader reloads MainConfig when one of its files changes or on SIGHUP.
+// A reload is applied as a whole or not at all: it is rejected when it fails to
+// load or validate, or when it changes a value not listed in liveKeys, which needs
+// a restart. The current config is kept then, none of the rejected edit is applied,
+// and the files are loaded again once they change again or on SIGHUP.
+type Reloader struct {
+	options  *ReloaderOptions
+	interval time.Duration
+	current  atomic.Value
+
+	mu          sync.Mutex
+	subscribers []func(old, next *MainConfig)
+	modTimes    map[string]time.Time
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// liveKeys are the values applied without restart, a key ending with a dot covers its section
+var liveKeys = []string{
+	"API.DefaultTimeout",
+	"Datadog.Version",
+	"Datadog.Team",
+	"Datadog.Region",
+	"Datadog.Tags",
+	"Sampling.",
+	"SamplingRule.",
+	"Log.",
+}
+
+// NewReloader init new reloader starting from the already loaded cfg
+func NewReloader(cfg *MainConfig, o *ReloaderOptions) *Reloader {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	r := &Reloader{
+		options:  o,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	r.current.Store(cfg)
+	r.modTimes = modTimes(Files())
+	return r
+}
+
+// Current returns the config currently applied
+func (r *Reloader) Current() *MainConfig {
+	return r.current.Load().(*MainConfig)
+}
+
+// Subscribe registers fn to be called with the previous and the next config after each successful reload
+func (r *Reloader) Subscribe(fn func(old, next *MainConfig)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Start watches the config files and SIGHUP in background until Stop is called
+func (r *Reloader) Start() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+				log.Println("SIGHUP received, reloading config")
+				r.Reload()
+			case <-ticker.C:
+				if r.changed() {
+					log.Println("config file changed, reloading config")
+					r.Reload()
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops watching
+func (r *Reloader) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	r.wg.Wait()
+}
+
+// Reload loads and validates the config again then applies it, unless it changes values needing a restart
+func (r *Reloader) Reload() error {
+	old := r.Current()
+	next := &MainConfig{}
+	l, err := loadLayers(next, r.options.Module, r.options.RootServicePath...)
+	if err == nil {
+		err = Validate(next)
+	}
+	if err == nil {
+		if restart := restartKeys(old, next); len(restart) > 0 {
+			err = fmt.Errorf("changed values requiring a restart: %s", strings.Join(restart, ", "))
+		}
+	}
+	if err != nil {
+		// the rejected files are not reloaded again until they change or on SIGHUP
+		r.mu.Lock()
+		r.modTimes = modTimes(Files())
+		r.mu.Unlock()
+
+		log.WithField("Error", err.Error()).Error("Config reload failed, keeping the current config")
+		r.count("failed")
+		return err
+	}
+
+	l.commit()
+	r.mu.Lock()
+	r.modTimes = modTimes(l.files)
+	subscribers := append([]func(old, next *MainConfig){}, r.subscribers...)
+	r.mu.Unlock()
+
+	r.current.Store(next)
+	for _, fn := range subscribers {
+		fn(old, next)
+	}
+
+	log.Println("Config reloaded")
+	r.count("success")
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for fname, t := range modTimes(Files()) {
+		if !r.modTimes[fname].Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) count(status string) {
+	if r.options.Metric == nil {
+		return
+	}
+	if err := r.options.Metric.Count(ReloadMetric, 1, []string{"status:" + status}, 1); err != nil {
+		log.Println("failed to submit config reload metric", err)
+	}
+}
+
+// restartKeys lists the keys changed between old and next which are not live
+func restartKeys(old, next *MainConfig) []string {
+	keys := []string{}
+	for _, k := range changedKeys(old, next) {
+		if !isLive(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func isLive(key string) bool {
+	for _, live := range liveKeys {
+		if key == live || (strings.HasSuffix(live, ".") && strings.HasPrefix(key, live)) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedKeys lists the keys whose value differs between a and b
+func changedKeys(a, b *MainConfig) []string {
+	va, vb := flatten(a), flatten(b)
+	keys := []string{}
+	for k, v := range va {
+		if vb[k] != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range vb {
+		if _, ok := va[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func modTimes(fnames []string) map[string]time.Time {
+	times := map[string]time.Time{}
+	for _, fname := range fnames {
+		if info, err := os.Stat(fname); err == nil {
+			times[fname] = info.ModTime()
+		}
+	}
+	return times
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+)
+
+func TestRestartKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(cfg *MainConfig)
+		want   []string
+	}{
+		{"unchanged", func(cfg *MainConfig) {}, nil},
+		{"live keys", func(cfg *MainConfig) {
+			cfg.API.DefaultTimeout = 20
+			cfg.Datadog.Team = "next"
+			cfg.Datadog.Tags = []string{"tier:next"}
+			cfg.Sampling.DefaultRate = 0.5
+			cfg.Log.Level = "debug"
+		}, nil},
+		{"live subsection", func(cfg *MainConfig) {
+			cfg.SamplingRule = map[string]*SamplingRuleConfig{"accounts": {Route: "/accounts", Rate: 0.1}}
+		}, nil},
+		{"restart keys", func(cfg *MainConfig) {
+			cfg.Server.Port = ":9001"
+			cfg.Datadog.Endpoint = "datadog-agent:8125"
+			cfg.Datadog.Team = "next"
+		}, []string{"Datadog.Endpoint", "Server.Port"}},
+		{"restart subsection", func(cfg *MainConfig) {
+			cfg.SLO = map[string]*SLOConfig{"accounts": {Route: "/accounts"}}
+		}, []string{"SLO.accounts.Availability", "SLO.accounts.Latency", "SLO.accounts.LatencyThreshold", "SLO.accounts.Route", "SLO.accounts.Window"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := validConfig()
+			tt.mutate(next)
+			if got := restartKeys(validConfig(), next); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("restartKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, cleanup := configDir(t, map[string]string{"main.ini": baseINI})
+	defer cleanup()
+	fname := filepath.Join(dir, "main.ini")
+
+	cfg := &MainConfig{}
+	if err := Load(cfg, "main", dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	m := metrictest.New()
+	r := NewReloader(cfg, &ReloaderOptions{Module: "main", RootServicePath: []string{dir}, Metric: m})
+	var notified []*MainConfig
+	r.Subscribe(func(old, next *MainConfig) {
+		notified = append(notified, old, next)
+	})
+
+	modTime := time.Now()
+	edit := func(old, new string) {
+		t.Helper()
+		writeConfig(t, dir, "main.ini", strings.Replace(baseINI, old, new, 1))
+		// the file system may not tell apart the mod times of quick writes
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(fname, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		old, new    string
+		wantErr     string
+		wantTimeout int
+	}{
+		{"needs a restart", "Port = :9000", "Port = :9001", "changed values requiring a restart: Server.Port", 10},
+		{"invalid", "DefaultTimeout = 10", "DefaultTimeout = 0", "API.DefaultTimeout: is required", 10},
+		{"unreadable", "[API]", "[API", "main.ini: 5:5: expected subsection name", 10},
+		{"live", "DefaultTimeout = 10", "DefaultTimeout = 20", "", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit(tt.old, tt.new)
+			if !r.changed() {
+				t.Fatal("changed() = false after the edit")
+			}
+			notified = nil
+			m.Reset()
+
+			err := r.Reload()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Reload() error = %v", err)
+				}
+				if len(notified) != 2 || notified[0] != cfg || notified[1] != r.Current() {
+					t.Errorf("subscriber called with %v, want the old and the next config", notified)
+				}
+				if got := m.Sum(ReloadMetric, "status:success"); got != 1 {
+					t.Errorf("%s status:success = %v, want 1", ReloadMetric, got)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Reload() error = %v, want %s", err, tt.wantErr)
+				}
+				if r.Current() != cfg {
+					t.Error("Current() changed by a rejected reload")
+				}
+				if len(notified) != 0 {
+					t.Error("subscriber called by a rejected reload")
+				}
+				if got := m.Sum(ReloadMetric, "status:failed"); got != 1 {
+					t.Errorf("%s status:failed = %v, want 1", ReloadMetric, got)
+				}
+			}
+			if got := r.Current().API.DefaultTimeout; got != tt.wantTimeout {
+				t.Errorf("API.DefaultTimeout = %d, want %d", got, tt.wantTimeout)
+			}
+			// the same files are not reloaded again until they change
+			if r.changed() {
+				t.Error("changed() = true after the reload")
+			}
+		})
+	}
+}
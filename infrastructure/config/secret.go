@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// SecretMask replaces the value of secrets in Dump
+const SecretMask = "******"
+
+// SecretProvider returns the secret referenced by ref
+type SecretProvider func(ref string) (string, error)
+
+// secretRef matches ${provider:ref}, e.g. ${env:DD_API_KEY} or ${file:/run/secrets/x}
+var secretRef = regexp.MustCompile(`\$\{(\w+):([^}]+)\}`)
+
+var secretProviders = map[string]SecretProvider{
+	"env":  envSecret,
+	"file": fileSecret,
+}
+
+// RegisterSecretProvider makes ${name:ref} references resolved by p
+func RegisterSecretProvider(name string, p SecretProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	secretProviders[name] = p
+}
+
+func envSecret(ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return v, nil
+}
+
+func fileSecret(ref string) (string, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// resolveSecrets replaces the secret references of every string value of cfg and
+// records their keys so Dump masks them
+func (l *load) resolveSecrets(cfg interface{}) error {
+	errs := []string{}
+	walkStrings(cfg, func(key string, v reflect.Value) {
+		if !secretRef.MatchString(v.String()) {
+			return
+		}
+		resolved := secretRef.ReplaceAllStringFunc(v.String(), func(ref string) string {
+			m := secretRef.FindStringSubmatch(ref)
+			mu.Lock()
+			provider, ok := secretProviders[m[1]]
+			mu.Unlock()
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: unknown secret provider %q", key, m[1]))
+				return ref
+			}
+			secret, err := provider(m[2])
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+				return ref
+			}
+			return secret
+		})
+		v.SetString(resolved)
+		l.secrets[key] = true
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to resolve secrets: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// walkStrings calls fn with every settable string of the cfg sections and named subsections,
+// strings of a slice share the key of the slice
+func walkStrings(cfg interface{}, fn func(key string, v reflect.Value)) {
+	root := reflect.Indirect(reflect.ValueOf(cfg))
+	if root.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i).Name
+		v := root.Field(i)
+		switch v.Kind() {
+		case reflect.Struct:
+			walkStructStrings(section, v, fn)
+		case reflect.Map:
+			for _, name := range v.MapKeys() {
+				sub := v.MapIndex(name)
+				if sub.Kind() == reflect.Ptr && sub.Elem().Kind() == reflect.Struct {
+					walkStructStrings(section+"."+name.String(), sub.Elem(), fn)
+				}
+			}
+		}
+	}
+}
+
+func walkStructStrings(prefix string, v reflect.Value, fn func(key string, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		key := prefix + "." + v.Type().Field(i).Name
+		switch {
+		case field.Kind() == reflect.String:
+			fn(key, field)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			for j := 0; j < field.Len(); j++ {
+				fn(key, field.Index(j))
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/validate"
+)
+
+// Validate checks cfg against the validate tags of its fields, plus the rules
+// spanning several fields of MainConfig. It returns a validate.Errors listing
+// every problem found, or nil.
+func Validate(cfg interface{}) error {
+	errs := validate.Errors{}
+	if err := validate.Struct(cfg); err != nil {
+		errs = append(errs, err.(validate.Errors)...)
+	}
+
+	if mainCfg, ok := cfg.(*MainConfig); ok {
+		errs = append(errs, validateMain(mainCfg)...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateMain(cfg *MainConfig) validate.Errors {
+	errs := validate.Errors{}
+
+	// the statsd client falls back to DD_AGENT_HOST when the endpoint is empty
+	endpoint := cfg.Datadog.Endpoint
+	switch strings.ToLower(cfg.Datadog.Transport) {
+	case "uds":
+		if strings.TrimPrefix(endpoint, "unix://") == "" {
+			errs = append(errs, validate.FieldError{Field: "Datadog.Endpoint", Rule: "required", Message: "socket path is required with uds transport"})
+		}
+	default:
+		if endpoint == "" && os.Getenv("DD_AGENT_HOST") == "" {
+			errs = append(errs, validate.FieldError{Field: "Datadog.Endpoint", Rule: "required", Message: "is required unless DD_AGENT_HOST is set"})
+		} else if endpoint != "" {
+			if _, _, err := net.SplitHostPort(endpoint); err != nil {
+				errs = append(errs, validate.FieldError{Field: "Datadog.Endpoint", Rule: "hostport", Message: "must be a host:port address with udp transport"})
+			}
+		}
+	}
+
+	// a shorter write timeout would cut the response of the handlers still within their timeout
+	if cfg.Server.WriteTimeout > 0 && cfg.Server.WriteTimeout <= cfg.API.DefaultTimeout {
+		errs = append(errs, validate.FieldError{Field: "Server.WriteTimeout", Rule: "min", Message: "must be greater than API.DefaultTimeout"})
+	}
+
+	// the drain delay is spent within the shutdown timeout, the requests need the rest to complete
+	if cfg.Server.ShutdownTimeout > 0 && cfg.Server.DrainDelay >= cfg.Server.ShutdownTimeout {
+		errs = append(errs, validate.FieldError{Field: "Server.DrainDelay", Rule: "max", Message: "must be less than Server.ShutdownTimeout"})
+	}
+
+	if cfg.Admin.Port != "" && cfg.Admin.Port == cfg.Server.Port {
+		errs = append(errs, validate.FieldError{Field: "Admin.Port", Rule: "ne", Message: "must differ from Server.Port"})
+	}
+
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		errs = append(errs, validate.FieldError{Field: "TLS.KeyFile", Rule: "required", Message: "CertFile and KeyFile must be set together"})
+	}
+	// the tls settings only apply to a tls listener, they would be silently ignored otherwise
+	if cfg.TLS.CertFile == "" {
+		for _, setting := range []struct {
+			field string
+			set   bool
+		}{
+			{"TLS.MinVersion", cfg.TLS.MinVersion != ""},
+			{"TLS.CipherSuites", len(cfg.TLS.CipherSuites) > 0},
+			{"TLS.ClientAuth", cfg.TLS.ClientAuth != "" && cfg.TLS.ClientAuth != "none"},
+			{"TLS.ClientCAFile", cfg.TLS.ClientCAFile != ""},
+			{"TLS.ReloadInterval", cfg.TLS.ReloadInterval > 0},
+		} {
+			if setting.set {
+				errs = append(errs, validate.FieldError{Field: setting.field, Rule: "required_with", Message: "requires TLS.CertFile"})
+			}
+		}
+	}
+	switch cfg.TLS.ClientAuth {
+	case "verify", "verify_if_given":
+		if cfg.TLS.ClientCAFile == "" {
+			errs = append(errs, validate.FieldError{Field: "TLS.ClientCAFile", Rule: "required", Message: "is required to verify client certificates"})
+		}
+	}
+
+	for name, rule := range cfg.SamplingRule {
+		if strings.ToLower(rule.Type) == "adaptive" && rule.TargetPerSecond <= 0 {
+			errs = append(errs, validate.FieldError{Field: "SamplingRule." + name + ".TargetPerSecond", Rule: "required", Message: "is required with adaptive type"})
+		}
+	}
+
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if strings.Count(origin, "*") > 1 {
+			errs = append(errs, validate.FieldError{Field: "CORS.AllowedOrigins", Rule: "wildcard", Message: "an origin may hold one * wildcard"})
+		}
+		if origin == "*" && cfg.CORS.AllowCredentials {
+			errs = append(errs, validate.FieldError{Field: "CORS.AllowCredentials", Rule: "excluded_with", Message: "cannot be set when any origin is allowed"})
+		}
+	}
+
+	for _, encoding := range cfg.Compression.Encodings {
+		switch strings.ToLower(encoding) {
+		case "br", "gzip":
+		default:
+			errs = append(errs, validate.FieldError{Field: "Compression.Encodings", Rule: "oneof", Message: "must be br or gzip"})
+		}
+	}
+
+	for _, method := range cfg.Auth.Methods {
+		switch strings.ToLower(method) {
+		case "apikey":
+			if len(cfg.Auth.APIKeys) == 0 {
+				errs = append(errs, validate.FieldError{Field: "Auth.APIKeys", Rule: "required", Message: "is required with the apikey method"})
+			}
+		case "hmac":
+			if len(cfg.Auth.HMACKeys) == 0 {
+				errs = append(errs, validate.FieldError{Field: "Auth.HMACKeys", Rule: "required", Message: "is required with the hmac method"})
+			}
+		case "jwt":
+			if cfg.Auth.JWKSFile == "" {
+				errs = append(errs, validate.FieldError{Field: "Auth.JWKSFile", Rule: "required", Message: "is required with the jwt method"})
+			}
+		default:
+			errs = append(errs, validate.FieldError{Field: "Auth.Methods", Rule: "oneof", Message: "must be apikey, hmac or jwt"})
+		}
+	}
+
+	for name, rl := range cfg.RateLimit {
+		switch {
+		case rl.Key == "", rl.Key == "ip", rl.Key == "forwarded_ip":
+		case rl.Key == "subject", strings.HasPrefix(rl.Key, "header:") && len(rl.Key) > len("header:"):
+			// the subject and header only key the authenticated requests
+			if len(cfg.Auth.Methods) == 0 {
+				errs = append(errs, validate.FieldError{Field: "RateLimit." + name + ".Key", Rule: "required_with", Message: "subject and header:<Name> require Auth.Methods"})
+			}
+		default:
+			errs = append(errs, validate.FieldError{Field: "RateLimit." + name + ".Key", Rule: "oneof", Message: "must be ip, forwarded_ip, subject or header:<Name>"})
+		}
+	}
+
+	for name, slo := range cfg.SLO {
+		if slo.Latency > 0 && slo.LatencyThreshold <= 0 {
+			errs = append(errs, validate.FieldError{Field: "SLO." + name + ".LatencyThreshold", Rule: "required", Message: "is required with a latency target"})
+		}
+	}
+
+	return errs
+}
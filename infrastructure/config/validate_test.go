@@ -0,0 +1,97 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/validate"
+)
+
+// validConfig returns the smallest config passing Validate
+func validConfig() *MainConfig {
+	cfg := &MainConfig{}
+	cfg.Server.Name = "ddogsvc"
+	cfg.Server.Port = ":9000"
+	cfg.API.DefaultTimeout = 10
+	cfg.Datadog.Endpoint = "localhost:8125"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	defer setEnv("DD_AGENT_HOST", "")()
+
+	tests := []struct {
+		name   string
+		mutate func(cfg *MainConfig)
+		// wantErr is the message of every error, empty when valid
+		wantErr string
+	}{
+		{"valid", func(cfg *MainConfig) {}, ""},
+		{"required", func(cfg *MainConfig) { cfg.Server.Name = "" }, "Server.Name: is required"},
+		{"several fields", func(cfg *MainConfig) {
+			cfg.Server.Port = "9000"
+			cfg.API.DefaultTimeout = 301
+		}, "Server.Port: must be a host:port address; API.DefaultTimeout: must be at most 300"},
+		{"oneof", func(cfg *MainConfig) { cfg.Datadog.Transport = "tcp" }, "Datadog.Transport: must be one of [udp, uds]"},
+		{"startswith in a subsection", func(cfg *MainConfig) {
+			cfg.SLO = map[string]*SLOConfig{"accounts": {Route: "accounts"}}
+		}, `SLO.accounts.Route: must start with "/"`},
+		{"endpoint", func(cfg *MainConfig) { cfg.Datadog.Endpoint = "" }, "Datadog.Endpoint: is required unless DD_AGENT_HOST is set"},
+		{"uds endpoint", func(cfg *MainConfig) {
+			cfg.Datadog.Transport = "uds"
+			cfg.Datadog.Endpoint = "unix://"
+		}, "Datadog.Endpoint: socket path is required with uds transport"},
+		{"write timeout", func(cfg *MainConfig) { cfg.Server.WriteTimeout = 10 }, "Server.WriteTimeout: must be greater than API.DefaultTimeout"},
+		{"drain delay", func(cfg *MainConfig) {
+			cfg.Server.ShutdownTimeout = 5
+			cfg.Server.DrainDelay = 5
+		}, "Server.DrainDelay: must be less than Server.ShutdownTimeout"},
+		{"admin port", func(cfg *MainConfig) { cfg.Admin.Port = ":9000" }, "Admin.Port: must differ from Server.Port"},
+		{"tls without cert", func(cfg *MainConfig) { cfg.TLS.MinVersion = "1.2" }, "TLS.MinVersion: requires TLS.CertFile"},
+		{"tls key", func(cfg *MainConfig) { cfg.TLS.CertFile = "cert.pem" }, "TLS.KeyFile: CertFile and KeyFile must be set together"},
+		{"adaptive rule", func(cfg *MainConfig) {
+			cfg.SamplingRule = map[string]*SamplingRuleConfig{"accounts": {Type: "adaptive"}}
+		}, "SamplingRule.accounts.TargetPerSecond: is required with adaptive type"},
+		{"cors credentials", func(cfg *MainConfig) {
+			cfg.CORS.AllowedOrigins = []string{"*"}
+			cfg.CORS.AllowCredentials = true
+		}, "CORS.AllowCredentials: cannot be set when any origin is allowed"},
+		{"auth method", func(cfg *MainConfig) { cfg.Auth.Methods = []string{"apikey"} }, "Auth.APIKeys: is required with the apikey method"},
+		{"rate limit subject", func(cfg *MainConfig) {
+			cfg.RateLimit = map[string]*RateLimitConfig{"public": {Key: "subject", Rate: 10}}
+		}, "RateLimit.public.Key: subject and header:<Name> require Auth.Methods"},
+		{"rate limit key", func(cfg *MainConfig) {
+			cfg.RateLimit = map[string]*RateLimitConfig{"public": {Key: "header:", Rate: 10}}
+		}, "RateLimit.public.Key: must be ip, forwarded_ip, subject or header:<Name>"},
+		{"slo latency", func(cfg *MainConfig) {
+			cfg.SLO = map[string]*SLOConfig{"accounts": {Route: "/accounts", Latency: 99}}
+		}, "SLO.accounts.LatencyThreshold: is required with a latency target"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(cfg)
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if _, ok := err.(validate.Errors); !ok {
+				t.Fatalf("Validate() error = %T %v, want validate.Errors", err, err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAgentHost(t *testing.T) {
+	defer setEnv("DD_AGENT_HOST", "datadog-agent")()
+	cfg := validConfig()
+	cfg.Datadog.Endpoint = ""
+	if err := Validate(cfg); err != nil {
+		t.Errorf("Validate() error = %v, want the DD_AGENT_HOST fallback", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package collector
+
+import (
+	"io/ioutil"
+	"syscall"
+	"time"
+)
+
+// openFDs counts the file descriptors opened by the current process
+func openFDs() (int, bool) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	return len(fds), true
+}
+
+// cpuTime returns the user and system cpu time consumed by the current process
+func cpuTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package collector
+
+import "time"
+
+// openFDs is only supported on linux
+func openFDs() (int, bool) {
+	return 0, false
+}
+
+// cpuTime is only supported on linux
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is used when the configured interval is not positive
+const DefaultInterval = 10 * time.Second
+
+// gcPauseQuantiles are the tags of the quantiles returned by debug.ReadGCStats
+var gcPauseQuantiles = []string{"min", "p25", "p50", "p75", "max"}
+
+// Options holds the runtime collector settings
+type Options struct {
+	Interval time.Duration
+}
+
+// Runtime periodically gauges go runtime and process statistics
+type Runtime struct {
+	metric   metric.MetricInterface
+	interval time.Duration
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+
+	lastCPU  time.Duration
+	lastTick time.Time
+}
+
+// NewRuntime init new runtime metric collector
+func NewRuntime(m metric.MetricInterface, o *Options) *Runtime {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Runtime{
+		metric:   m,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the collector in background until Stop is called
+func (r *Runtime) Start() {
+	r.lastCPU, _ = cpuTime()
+	r.lastTick = time.Now()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.collect()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the collector and waits for the running collection to finish
+func (r *Runtime) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	r.wg.Wait()
+}
+
+func (r *Runtime) collect() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	r.gauge("runtime.goroutines", float64(runtime.NumGoroutine()), nil)
+	r.gauge("runtime.heap_alloc", float64(mem.HeapAlloc), nil)
+	r.gauge("runtime.heap_inuse", float64(mem.HeapInuse), nil)
+	r.gauge("runtime.num_gc", float64(mem.NumGC), nil)
+
+	stats := debug.GCStats{PauseQuantiles: make([]time.Duration, len(gcPauseQuantiles))}
+	debug.ReadGCStats(&stats)
+	if stats.NumGC > 0 {
+		for i, q := range gcPauseQuantiles {
+			r.gauge("runtime.gc_pause", stats.PauseQuantiles[i].Seconds()*1000, []string{"quantile:" + q})
+		}
+	}
+
+	if fds, ok := openFDs(); ok {
+		r.gauge("runtime.open_fds", float64(fds), nil)
+	}
+
+	if cpu, ok := cpuTime(); ok {
+		now := time.Now()
+		if elapsed := now.Sub(r.lastTick); elapsed > 0 {
+			// percent of a single core, may exceed 100 on multi core usage
+			r.gauge("runtime.cpu_percent", float64(cpu-r.lastCPU)/float64(elapsed)*100, nil)
+		}
+		r.lastCPU = cpu
+		r.lastTick = now
+	}
+}
+
+func (r *Runtime) gauge(name string, value float64, tags []string) {
+	if err := r.metric.Gauge(name, value, tags, 1); err != nil {
+		log.Println("failed to submit runtime metric", name, err)
+	}
+}
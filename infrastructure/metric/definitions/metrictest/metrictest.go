@@ -0,0 +1,120 @@
+// Package metrictest provides a definitions.MetricInterface recording the submitted
+// points, for the tests of the packages sending metrics.
+package metrictest
+
+import (
+	"sync"
+	"time"
+)
+
+// Metric types of the recorded points
+const (
+	TypeCount     = "count"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Point is a submitted point, the Histogram values are the durations in milliseconds
+type Point struct {
+	Type  string
+	Name  string
+	Value float64
+	Tags  []string
+	Rate  float64
+}
+
+// HasTags reports whether the point holds every tag of tags
+func (p Point) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range p.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Recorder records the points it is sent, it is safe for concurrent use.
+// Every submission returns Err.
+type Recorder struct {
+	Err error
+
+	mu     sync.Mutex
+	points []Point
+}
+
+// New init new recorder
+func New() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) record(p Point) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = append(r.points, p)
+	return r.Err
+}
+
+// Count records a count point
+func (r *Recorder) Count(name string, value int64, tags []string, rate float64) error {
+	return r.record(Point{Type: TypeCount, Name: name, Value: float64(value), Tags: tags, Rate: rate})
+}
+
+// Gauge records a gauge point
+func (r *Recorder) Gauge(name string, value float64, tags []string, rate float64) error {
+	return r.record(Point{Type: TypeGauge, Name: name, Value: value, Tags: tags, Rate: rate})
+}
+
+// Histogram records a histogram point of the milliseconds elapsed since startTime
+func (r *Recorder) Histogram(name string, startTime time.Time, tags []string, rate float64) error {
+	return r.record(Point{Type: TypeHistogram, Name: name, Value: float64(time.Since(startTime)) / float64(time.Millisecond), Tags: tags, Rate: rate})
+}
+
+// HistogramValue records a histogram point
+func (r *Recorder) HistogramValue(name string, value float64, tags []string, rate float64) error {
+	return r.record(Point{Type: TypeHistogram, Name: name, Value: value, Tags: tags, Rate: rate})
+}
+
+// Points returns the points named name holding every tag of tags, in submission order
+func (r *Recorder) Points(name string, tags ...string) []Point {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points := []Point{}
+	for _, p := range r.points {
+		if p.Name == name && p.HasTags(tags...) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// Last returns the last point named name holding every tag of tags
+func (r *Recorder) Last(name string, tags ...string) (Point, bool) {
+	points := r.Points(name, tags...)
+	if len(points) == 0 {
+		return Point{}, false
+	}
+	return points[len(points)-1], true
+}
+
+// Sum returns the sum of the values of the points named name holding every tag of tags
+func (r *Recorder) Sum(name string, tags ...string) float64 {
+	sum := 0.0
+	for _, p := range r.Points(name, tags...) {
+		sum += p.Value
+	}
+	return sum
+}
+
+// Reset drops the recorded points
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = nil
+}
@@ -4,28 +4,42 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/instance"
+)
+
+// Transport list
+const (
+	TransportUDP = "udp"
+	TransportUDS = "uds"
 )
 
 // Datadog to hold datadog client state
 type Datadog struct {
 	client *statsd.Client
+
+	serviceName string
+	env         string
+	instance    instance.Metadata
+	// global tags appended to every metric, replaced by SetConfig
+	tags atomic.Value
 }
 
-// New init new datadog client
-func New(serviceName, env, source string) *Datadog {
-	datadog, err := statsd.New(source)
+// New init new datadog client, the instance metadata is sent as global tags
+func New(serviceName, env string, cfg config.DatadogConfig, meta instance.Metadata) *Datadog {
+	addr, err := address(cfg)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
 	// Get hostname
-	host, err := os.Hostname()
-	if err != nil {
-		host = "undefined"
+	if meta.Hostname == "" {
+		meta.Hostname = "undefined"
 	}
 
 	// Get service name
@@ -33,19 +47,86 @@ func New(serviceName, env, source string) *Datadog {
 		log.Fatal(errors.New("Datadog service name should be provided"))
 	}
 
-	datadog.Namespace = fmt.Sprintf("enterprise_%s.", serviceName)
-	datadog.Tags = append(datadog.Tags, "env:"+env, "host:"+host)
+	opts := append(options(cfg), statsd.WithNamespace(namespace(serviceName, cfg)))
+	datadog, err := statsd.New(addr, opts...)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
 	log.Println("Datadog initialized...")
 
-	return &Datadog{
-		client: datadog,
+	d := &Datadog{
+		client:      datadog,
+		serviceName: serviceName,
+		env:         env,
+		instance:    meta,
+	}
+	d.tags.Store(globalTags(serviceName, env, meta, cfg))
+	return d
+}
+
+// SetConfig recomputes the global tags from a reloaded config, the other values need a new client
+func (datadog *Datadog) SetConfig(cfg config.DatadogConfig) {
+	datadog.tags.Store(globalTags(datadog.serviceName, datadog.env, datadog.instance, cfg))
+}
+
+// withGlobalTags returns tags followed by the global tags
+func (datadog *Datadog) withGlobalTags(tags []string) []string {
+	global := datadog.tags.Load().([]string)
+	all := make([]string, 0, len(tags)+len(global))
+	return append(append(all, tags...), global...)
+}
+
+// address builds the dogstatsd address for the configured transport
+func address(cfg config.DatadogConfig) (string, error) {
+	switch strings.ToLower(cfg.Transport) {
+	case "", TransportUDP:
+		return cfg.Endpoint, nil
+	case TransportUDS:
+		if strings.HasPrefix(cfg.Endpoint, statsd.UnixAddressPrefix) {
+			return cfg.Endpoint, nil
+		}
+		return statsd.UnixAddressPrefix + cfg.Endpoint, nil
+	}
+	return "", fmt.Errorf("unknown datadog transport %q", cfg.Transport)
+}
+
+// options maps the config onto statsd client options, leaving zero values to the client defaults
+func options(cfg config.DatadogConfig) []statsd.Option {
+	opts := []statsd.Option{}
+	if cfg.MaxMessagesPerPayload > 0 {
+		opts = append(opts, statsd.WithMaxMessagesPerPayload(cfg.MaxMessagesPerPayload))
+	}
+	if cfg.MaxBytesPerPayload > 0 {
+		opts = append(opts, statsd.WithMaxBytesPerPayload(cfg.MaxBytesPerPayload))
+	}
+	if cfg.BufferPoolSize > 0 {
+		opts = append(opts, statsd.WithBufferPoolSize(cfg.BufferPoolSize))
+	}
+	if cfg.BufferFlushInterval > 0 {
+		opts = append(opts, statsd.WithBufferFlushInterval(time.Duration(cfg.BufferFlushInterval)*time.Millisecond))
+	}
+	if cfg.SenderQueueSize > 0 {
+		opts = append(opts, statsd.WithSenderQueueSize(cfg.SenderQueueSize))
+	}
+	if cfg.WriteTimeoutUDS > 0 {
+		opts = append(opts, statsd.WithWriteTimeoutUDS(time.Duration(cfg.WriteTimeoutUDS)*time.Millisecond))
+	}
+	if cfg.ChannelMode {
+		opts = append(opts, statsd.WithChannelMode())
+		if cfg.ChannelModeBufferSize > 0 {
+			opts = append(opts, statsd.WithChannelModeBufferSize(cfg.ChannelModeBufferSize))
+		}
 	}
+	if cfg.DisableTelemetry {
+		opts = append(opts, statsd.WithoutTelemetry())
+	}
+	return opts
 }
 
 // Count tracks how many times something happened per second
 func (datadog *Datadog) Count(name string, value int64, tags []string, rate float64) error {
-	err := datadog.client.Count(name, value, tags, rate)
+	err := datadog.client.Count(name, value, datadog.withGlobalTags(tags), rate)
 	if err != nil {
 		return err
 	}
@@ -54,7 +135,7 @@ func (datadog *Datadog) Count(name string, value int64, tags []string, rate floa
 
 // Gauge measures the value of a metric at a particular time
 func (datadog *Datadog) Gauge(name string, value float64, tags []string, rate float64) error {
-	err := datadog.client.Gauge(name, value, tags, rate)
+	err := datadog.client.Gauge(name, value, datadog.withGlobalTags(tags), rate)
 	if err != nil {
 		return err
 	}
@@ -62,11 +143,24 @@ func (datadog *Datadog) Gauge(name string, value float64, tags []string, rate fl
 }
 
 // Histogram tracks the statistical distribution of a set of values on each host
-func (datadog *Datadog) Histogram(name string, startTime time.Time, tags []string) error {
+func (datadog *Datadog) Histogram(name string, startTime time.Time, tags []string, rate float64) error {
 	elapsedTime := time.Since(startTime).Seconds() * 1000
-	err := datadog.client.Histogram(name, elapsedTime, tags, float64(1))
+	err := datadog.client.Histogram(name, elapsedTime, datadog.withGlobalTags(tags), rate)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// HistogramValue tracks the statistical distribution of value, e.g. a size
+func (datadog *Datadog) HistogramValue(name string, value float64, tags []string, rate float64) error {
+	return datadog.client.Histogram(name, value, datadog.withGlobalTags(tags), rate)
+}
+
+// Close flushes the buffered metrics and closes the client
+func (datadog *Datadog) Close() error {
+	if err := datadog.client.Flush(); err != nil {
+		return err
+	}
+	return datadog.client.Close()
+}
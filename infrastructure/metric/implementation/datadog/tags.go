@@ -0,0 +1,111 @@
+package datadog
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/validator"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/instance"
+)
+
+// Unified service tagging environment variables
+const (
+	EnvDDEnv     = "DD_ENV"
+	EnvDDService = "DD_SERVICE"
+	EnvDDVersion = "DD_VERSION"
+	EnvDDTags    = "DD_TAGS"
+)
+
+// namespace returns the configured namespace, defaulting to enterprise_<service>.
+func namespace(serviceName string, cfg config.DatadogConfig) string {
+	ns := cfg.Namespace
+	if ns == "" {
+		ns = fmt.Sprintf("enterprise_%s", serviceName)
+	}
+	if !strings.HasSuffix(ns, ".") {
+		ns += "."
+	}
+	return ns
+}
+
+// globalTags resolves the constant tags sent with every metric.
+// Precedence from lowest to highest: instance metadata, config Team/Region/Tags, DD_TAGS, then
+// env/service/version where DD_ENV/DD_SERVICE/DD_VERSION beat the configured values. The
+// version falls back to the one linked in buildinfo.
+// A later tag replaces an earlier one with the same key. The tags are normalized like the
+// ones of each metric, the invalid ones are dropped.
+func globalTags(serviceName, env string, meta instance.Metadata, cfg config.DatadogConfig) []string {
+	tags := meta.Tags()
+	if cfg.Team != "" {
+		tags = mergeTag(tags, "team:"+cfg.Team)
+	}
+	if cfg.Region != "" {
+		tags = mergeTag(tags, "region:"+cfg.Region)
+	}
+	for _, t := range cfg.Tags {
+		tags = mergeTag(tags, t)
+	}
+	for _, t := range parseDDTags(os.Getenv(EnvDDTags)) {
+		tags = mergeTag(tags, t)
+	}
+
+	tags = mergeTag(tags, "env:"+firstNonEmpty(os.Getenv(EnvDDEnv), env))
+	tags = mergeTag(tags, "service:"+firstNonEmpty(os.Getenv(EnvDDService), serviceName))
+	tags = mergeTag(tags, "version:"+firstNonEmpty(os.Getenv(EnvDDVersion), cfg.Version, buildinfo.Version))
+
+	return normalizeTags(tags)
+}
+
+// normalizeTags applies the metric validator rules to the global tags, dropping the invalid ones
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		t, reason := validator.NormalizeTag(tag)
+		if reason != "" {
+			log.Printf("dropping global tag %q: %s", tag, reason)
+			continue
+		}
+		normalized = append(normalized, t)
+	}
+	return normalized
+}
+
+// parseDDTags splits DD_TAGS, which may be separated by commas or spaces
+func parseDDTags(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// mergeTag appends tag, replacing any existing tag with the same key
+func mergeTag(tags []string, tag string) []string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return tags
+	}
+	key := tagKey(tag)
+	for i, t := range tags {
+		if tagKey(t) == key {
+			tags[i] = tag
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
+
+func tagKey(tag string) string {
+	return strings.SplitN(tag, ":", 2)[0]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
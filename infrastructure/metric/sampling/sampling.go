@@ -0,0 +1,239 @@
+package sampling
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/env"
+	log "github.com/sirupsen/logrus"
+)
+
+// Policy types
+const (
+	TypeFixed    = "fixed"
+	TypeAdaptive = "adaptive"
+)
+
+// DefaultErrorStatus is the lowest http status counted as an error, see Options.ErrorStatus
+const DefaultErrorStatus = 500
+
+// MinRate is the lowest rate a policy may return so a metric never disappears completely
+const MinRate = 0.001
+
+// Policy decides the sample rate of a metric submission.
+// The rate is passed as is to the metric client, which drops the submission
+// randomly and sends the rate along so datadog upscales counts. Callers must not
+// drop submissions themselves.
+type Policy interface {
+	Rate(name, route string, isError bool) float64
+}
+
+// IsErrorStatus tells whether the http status is an error for p, i.e. sampled at rate 1 when
+// AlwaysSampleErrors is set. The statuses from DefaultErrorStatus are errors unless p is a
+// Sampler with another Options.ErrorStatus.
+func IsErrorStatus(p Policy, status int) bool {
+	if s, ok := p.(interface{ IsErrorStatus(status int) bool }); ok {
+		return s.IsErrorStatus(status)
+	}
+	return status >= DefaultErrorStatus
+}
+
+// Fixed always returns the same rate
+type Fixed float64
+
+// Rate returns the fixed rate
+func (f Fixed) Rate(name, route string, isError bool) float64 {
+	return clamp(float64(f))
+}
+
+// Adaptive lowers the rate as the throughput of a metric/route grows, aiming to
+// submit about TargetPerSecond samples per second for each of them
+type Adaptive struct {
+	target float64
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count float64
+	rate  float64
+}
+
+// NewAdaptive init new adaptive policy
+func NewAdaptive(targetPerSecond float64) *Adaptive {
+	return &Adaptive{
+		target:  targetPerSecond,
+		windows: map[string]*window{},
+	}
+}
+
+// Rate returns the rate computed from the throughput seen in the previous second
+func (a *Adaptive) Rate(name, route string, isError bool) float64 {
+	key := name + "|" + route
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.windows[key]
+	if !ok {
+		w = &window{start: now, rate: 1}
+		a.windows[key] = w
+	}
+	if elapsed := now.Sub(w.start); elapsed >= time.Second {
+		perSecond := w.count / elapsed.Seconds()
+		w.rate = 1
+		if perSecond > a.target {
+			w.rate = clamp(a.target / perSecond)
+		}
+		w.start = now
+		w.count = 0
+	}
+	w.count++
+
+	return w.rate
+}
+
+// Rule applies a policy to a metric name and/or route, an empty field matches anything
+type Rule struct {
+	Metric string
+	Route  string
+	Policy Policy
+}
+
+func (r Rule) match(name, route string) bool {
+	return (r.Metric == "" || r.Metric == name) && (r.Route == "" || r.Route == route)
+}
+
+func (r Rule) specificity() int {
+	s := 0
+	if r.Metric != "" {
+		s++
+	}
+	if r.Route != "" {
+		s++
+	}
+	return s
+}
+
+// Options holds the sampler settings
+type Options struct {
+	Default            Policy
+	AlwaysSampleErrors bool
+	// ErrorStatus is the lowest http status counted as an error, DefaultErrorStatus when zero
+	ErrorStatus int
+	Rules       []Rule
+}
+
+// Sampler picks the policy of the most specific matching rule
+type Sampler struct {
+	mu                 sync.RWMutex
+	def                Policy
+	alwaysSampleErrors bool
+	errorStatus        int
+	rules              []Rule
+}
+
+// New init new sampler, rules are ordered from the most specific one
+func New(o *Options) *Sampler {
+	s := &Sampler{}
+	s.Update(o)
+	return s
+}
+
+// NewFromConfig init new sampler from the sampling config sections
+func NewFromConfig(cfg config.SamplingConfig, rules map[string]*config.SamplingRuleConfig) *Sampler {
+	return New(optionsFromConfig(cfg, rules))
+}
+
+// Update replaces the sampler settings, it is safe to call while sampling
+func (s *Sampler) Update(o *Options) {
+	def := o.Default
+	if def == nil {
+		def = Fixed(1)
+	}
+	rules := append([]Rule{}, o.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity() > rules[j].specificity()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.def = def
+	s.alwaysSampleErrors = o.AlwaysSampleErrors
+	s.errorStatus = o.ErrorStatus
+	if s.errorStatus <= 0 {
+		s.errorStatus = DefaultErrorStatus
+	}
+	s.rules = rules
+}
+
+// IsErrorStatus tells whether the http status is counted as an error
+func (s *Sampler) IsErrorStatus(status int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return status >= s.errorStatus
+}
+
+// UpdateFromConfig replaces the sampler settings with the ones of a reloaded config
+func (s *Sampler) UpdateFromConfig(cfg config.SamplingConfig, rules map[string]*config.SamplingRuleConfig) {
+	s.Update(optionsFromConfig(cfg, rules))
+}
+
+// optionsFromConfig maps the config, an empty DefaultRate falls back to the environment default
+func optionsFromConfig(cfg config.SamplingConfig, rules map[string]*config.SamplingRuleConfig) *Options {
+	rate := cfg.DefaultRate
+	if rate == 0 {
+		rate = env.Current().SampleRate
+	}
+	o := &Options{
+		Default:            Fixed(rate),
+		AlwaysSampleErrors: cfg.AlwaysSampleErrors,
+		ErrorStatus:        cfg.ErrorStatus,
+	}
+	for name, r := range rules {
+		var policy Policy
+		switch strings.ToLower(r.Type) {
+		case "", TypeFixed:
+			policy = Fixed(r.Rate)
+		case TypeAdaptive:
+			policy = NewAdaptive(r.TargetPerSecond)
+		default:
+			log.Printf("unknown sampling type %q of rule %s, rule ignored", r.Type, name)
+			continue
+		}
+		o.Rules = append(o.Rules, Rule{Metric: r.Metric, Route: r.Route, Policy: policy})
+	}
+	return o
+}
+
+// Rate returns the sample rate for a submission of metric name on route
+func (s *Sampler) Rate(name, route string, isError bool) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if isError && s.alwaysSampleErrors {
+		return 1
+	}
+	for _, r := range s.rules {
+		if r.match(name, route) {
+			return r.Policy.Rate(name, route, isError)
+		}
+	}
+	return s.def.Rate(name, route, isError)
+}
+
+func clamp(rate float64) float64 {
+	if rate <= 0 || rate > 1 {
+		return 1
+	}
+	if rate < MinRate {
+		return MinRate
+	}
+	return rate
+}
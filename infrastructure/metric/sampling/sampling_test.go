@@ -0,0 +1,165 @@
+package sampling
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+)
+
+func TestFixed(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want float64
+	}{
+		{0.5, 0.5},
+		{1, 1},
+		// out of range rates sample everything
+		{0, 1},
+		{-0.1, 1},
+		{1.5, 1},
+		{0.00001, MinRate},
+	}
+	for _, tt := range tests {
+		if got := Fixed(tt.rate).Rate("http_router", "/accounts", false); got != tt.want {
+			t.Errorf("Fixed(%v).Rate() = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestSamplerRules(t *testing.T) {
+	s := New(&Options{
+		Default: Fixed(0.5),
+		// listed from the least specific, the most specific matching rule applies
+		Rules: []Rule{
+			{Metric: "http_router", Policy: Fixed(0.3)},
+			{Route: "/accounts", Policy: Fixed(0.2)},
+			{Route: "/accounts", Policy: Fixed(0.25)},
+			{Metric: "http_router", Route: "/accounts", Policy: Fixed(0.1)},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		metric string
+		route  string
+		want   float64
+	}{
+		{"metric and route", "http_router", "/accounts", 0.1},
+		{"metric", "http_router", "/customers", 0.3},
+		// the first of the rules as specific applies
+		{"route", "http_response.size", "/accounts", 0.2},
+		{"default", "http_response.size", "/customers", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Rate(tt.metric, tt.route, false); got != tt.want {
+				t.Errorf("Rate(%s, %s) = %v, want %v", tt.metric, tt.route, got, tt.want)
+			}
+		})
+	}
+
+	if got := New(&Options{}).Rate("http_router", "/accounts", false); got != 1 {
+		t.Errorf("Rate() without default = %v, want 1", got)
+	}
+}
+
+func TestSamplerErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     Options
+		status      int
+		wantIsError bool
+		wantRate    float64
+	}{
+		{"server error", Options{Default: Fixed(0.1), AlwaysSampleErrors: true}, 500, true, 1},
+		{"client error", Options{Default: Fixed(0.1), AlwaysSampleErrors: true}, 404, false, 0.1},
+		{"client errors kept", Options{Default: Fixed(0.1), AlwaysSampleErrors: true, ErrorStatus: 400}, 404, true, 1},
+		{"errors sampled", Options{Default: Fixed(0.1)}, 500, true, 0.1},
+		{"rule ignored for errors", Options{Rules: []Rule{{Route: "/accounts", Policy: Fixed(0.1)}}, AlwaysSampleErrors: true}, 503, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&tt.options)
+			isError := IsErrorStatus(s, tt.status)
+			if isError != tt.wantIsError {
+				t.Errorf("IsErrorStatus(%d) = %v, want %v", tt.status, isError, tt.wantIsError)
+			}
+			if got := s.Rate("http_router", "/accounts", isError); got != tt.wantRate {
+				t.Errorf("Rate() = %v, want %v", got, tt.wantRate)
+			}
+		})
+	}
+
+	// a policy other than a Sampler counts the server errors
+	if !IsErrorStatus(Fixed(1), 500) || IsErrorStatus(Fixed(1), 499) {
+		t.Errorf("IsErrorStatus() of a policy does not start at %d", DefaultErrorStatus)
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	a := NewAdaptive(10)
+	for i := 0; i < 100; i++ {
+		if got := a.Rate("http_router", "/accounts", false); got != 1 {
+			t.Fatalf("Rate() = %v in the first second, want 1", got)
+		}
+	}
+	a.Rate("http_router", "/customers", false)
+
+	// a second went by with 100 submissions, 10 times the target
+	a.windows["http_router|/accounts"].start = time.Now().Add(-time.Second)
+	a.windows["http_router|/customers"].start = time.Now().Add(-time.Second)
+	if got := a.Rate("http_router", "/accounts", false); math.Abs(got-0.1) > 0.005 {
+		t.Errorf("Rate() = %v, want about 0.1", got)
+	}
+	if got := a.Rate("http_router", "/accounts", false); math.Abs(got-0.1) > 0.005 {
+		t.Errorf("Rate() = %v within the window, want the rate of the previous one", got)
+	}
+	if got := a.Rate("http_router", "/customers", false); got != 1 {
+		t.Errorf("Rate() of another route = %v, want 1 under the target", got)
+	}
+
+	// the rate goes back up once the throughput falls
+	a.windows["http_router|/accounts"].start = time.Now().Add(-time.Second)
+	if got := a.Rate("http_router", "/accounts", false); got != 1 {
+		t.Errorf("Rate() = %v after a quiet second, want 1", got)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	s := NewFromConfig(config.SamplingConfig{AlwaysSampleErrors: true, ErrorStatus: 400}, map[string]*config.SamplingRuleConfig{
+		"accounts":  {Route: "/accounts", Rate: 0.2},
+		"router":    {Metric: "http_router", Type: "Adaptive", TargetPerSecond: 10},
+		"customers": {Route: "/customers", Type: "dynamic", Rate: 0.3},
+	})
+
+	tests := []struct {
+		name    string
+		metric  string
+		route   string
+		isError bool
+		want    float64
+	}{
+		{"fixed rule", "http_response.size", "/accounts", false, 0.2},
+		{"adaptive rule", "http_router", "/customers", false, 1},
+		// unknown types are ignored
+		{"environment default", "http_response.size", "/customers", false, 1},
+		{"errors", "http_response.size", "/accounts", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Rate(tt.metric, tt.route, tt.isError); got != tt.want {
+				t.Errorf("Rate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !s.IsErrorStatus(400) {
+		t.Error("IsErrorStatus(400) = false with ErrorStatus 400")
+	}
+
+	s.UpdateFromConfig(config.SamplingConfig{DefaultRate: 0.5}, nil)
+	if got := s.Rate("http_router", "/accounts", true); got != 0.5 {
+		t.Errorf("Rate() after an update = %v, want 0.5", got)
+	}
+}
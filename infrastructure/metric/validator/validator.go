@@ -0,0 +1,205 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	log "github.com/sirupsen/logrus"
+)
+
+// Datadog naming limits
+const (
+	MaxNameLength = 200
+	MaxTagLength  = 200
+)
+
+// MaxReported bounds the offenders remembered to log each of them once, the set is
+// emptied when full so high cardinality offenders cannot grow it without bound
+const MaxReported = 1000
+
+// ViolationMetric is the counter incremented on every rejected name or tag
+const ViolationMetric = "metric.validation.violation"
+
+// violation reasons
+const (
+	reasonInvalidName = "invalid_name"
+	reasonInvalidTag  = "invalid_tag"
+)
+
+// ErrInvalidMetricName is returned when a metric is dropped because of its name
+var ErrInvalidMetricName = errors.New("invalid metric name")
+
+// Validator wraps a MetricInterface and enforces datadog naming rules before submission.
+// Metrics with an invalid name are dropped, invalid tags are normalized or dropped.
+type Validator struct {
+	next metric.MetricInterface
+
+	mu       sync.Mutex
+	reported map[string]struct{}
+}
+
+// New init new validating metric wrapper
+func New(next metric.MetricInterface) *Validator {
+	return &Validator{next: next, reported: map[string]struct{}{}}
+}
+
+// Count tracks how many times something happened per second
+func (v *Validator) Count(name string, value int64, tags []string, rate float64) error {
+	if err := v.checkName(name); err != nil {
+		return err
+	}
+	return v.next.Count(name, value, v.normalizeTags(name, tags), rate)
+}
+
+// Gauge measures the value of a metric at a particular time
+func (v *Validator) Gauge(name string, value float64, tags []string, rate float64) error {
+	if err := v.checkName(name); err != nil {
+		return err
+	}
+	return v.next.Gauge(name, value, v.normalizeTags(name, tags), rate)
+}
+
+// Histogram tracks the statistical distribution of a set of values on each host
+func (v *Validator) Histogram(name string, startTime time.Time, tags []string, rate float64) error {
+	if err := v.checkName(name); err != nil {
+		return err
+	}
+	return v.next.Histogram(name, startTime, v.normalizeTags(name, tags), rate)
+}
+
+// HistogramValue tracks the statistical distribution of value, e.g. a size
+func (v *Validator) HistogramValue(name string, value float64, tags []string, rate float64) error {
+	if err := v.checkName(name); err != nil {
+		return err
+	}
+	return v.next.HistogramValue(name, value, v.normalizeTags(name, tags), rate)
+}
+
+func (v *Validator) checkName(name string) error {
+	if reason := validateName(name); reason != "" {
+		v.report(reasonInvalidName, name, reason)
+		return fmt.Errorf("%w %q: %s", ErrInvalidMetricName, name, reason)
+	}
+	return nil
+}
+
+func (v *Validator) normalizeTags(name string, tags []string) []string {
+	if len(tags) == 0 {
+		return tags
+	}
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		t, reason := NormalizeTag(tag)
+		if reason != "" {
+			v.report(reasonInvalidTag, name+" "+tag, reason)
+			continue
+		}
+		normalized = append(normalized, t)
+	}
+	return normalized
+}
+
+// report counts the violation and logs it once per unique offender
+func (v *Validator) report(kind, offender, reason string) {
+	if err := v.next.Count(ViolationMetric, 1, []string{"reason:" + kind}, 1); err != nil {
+		log.Println("failed to submit metric validation violation", err)
+	}
+	if v.firstReport(kind + "|" + offender) {
+		log.WithFields(log.Fields{
+			"Kind":     kind,
+			"Offender": offender,
+			"Reason":   reason,
+		}).Warn("Metric validation violation")
+	}
+}
+
+// firstReport returns whether key is reported for the first time since the set was last emptied
+func (v *Validator) firstReport(key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.reported[key]; ok {
+		return false
+	}
+	if len(v.reported) >= MaxReported {
+		v.reported = map[string]struct{}{}
+	}
+	v.reported[key] = struct{}{}
+	return true
+}
+
+// validateName returns the reason why name is not a valid datadog metric name, empty if valid
+func validateName(name string) string {
+	if name == "" {
+		return "empty name"
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Sprintf("longer than %d characters", MaxNameLength)
+	}
+	if !isLetter(rune(name[0])) {
+		return "must start with a letter"
+	}
+	for _, r := range name {
+		if !isLetter(r) && !isDigit(r) && r != '_' && r != '.' {
+			return fmt.Sprintf("invalid character %q", r)
+		}
+	}
+	return ""
+}
+
+// NormalizeTag trims and lowercases the tag key and replaces invalid characters with underscores.
+// It returns the reason when the tag cannot be fixed, empty if valid.
+func NormalizeTag(tag string) (string, string) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", "empty tag"
+	}
+
+	parts := strings.SplitN(tag, ":", 2)
+	key := sanitizeTag(strings.ToLower(strings.TrimSpace(parts[0])))
+	if key == "" {
+		return "", "empty tag key"
+	}
+	if !isLetter(rune(key[0])) {
+		return "", "tag key must start with a letter"
+	}
+
+	normalized := key
+	if len(parts) == 2 {
+		value := sanitizeTag(strings.TrimSpace(parts[1]))
+		if value == "" {
+			return "", "empty tag value"
+		}
+		normalized = key + ":" + value
+	}
+
+	if len(normalized) > MaxTagLength {
+		return "", fmt.Sprintf("longer than %d characters", MaxTagLength)
+	}
+	return normalized, ""
+}
+
+// sanitizeTag replaces characters not allowed in datadog tags with underscores
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isLetter(r) || isDigit(r) {
+			return r
+		}
+		switch r {
+		case '_', '-', ':', '.', '/':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"http_router", ""},
+		{"slo.burn_rate", ""},
+		{"limiter.in_flight2", ""},
+		{"", "empty name"},
+		{"2xx.count", "must start with a letter"},
+		{"_private", "must start with a letter"},
+		{"http-router", `invalid character '-'`},
+		{"latency ms", `invalid character ' '`},
+		{"métrique", `invalid character 'é'`},
+		{strings.Repeat("a", MaxNameLength), ""},
+		{strings.Repeat("a", MaxNameLength+1), "longer than 200 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateName(tt.name); got != tt.want {
+				t.Errorf("validateName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag        string
+		want       string
+		wantReason string
+	}{
+		{"url_path:/v1/accounts", "url_path:/v1/accounts", ""},
+		{"env", "env", ""},
+		{" Env : Production ", "env:Production", ""},
+		{"region:ap-southeast-1", "region:ap-southeast-1", ""},
+		{"version:1.2.3+build", "version:1.2.3_build", ""},
+		{"url:/accounts?id=1", "url:/accounts_id_1", ""},
+		{"team name:core api", "team_name:core_api", ""},
+		{"key:a:b", "key:a:b", ""},
+		{"", "", "empty tag"},
+		{"  ", "", "empty tag"},
+		{":value", "", "empty tag key"},
+		{"2xx:true", "", "tag key must start with a letter"},
+		{"env:", "", "empty tag value"},
+		{"key:" + strings.Repeat("a", MaxTagLength), "", "longer than 200 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, reason := NormalizeTag(tt.tag)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("NormalizeTag(%q) = %q, %q, want %q, %q", tt.tag, got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	m := metrictest.New()
+	v := New(m)
+
+	submit := map[string]func(name string, tags []string) error{
+		"count":           func(name string, tags []string) error { return v.Count(name, 1, tags, 1) },
+		"gauge":           func(name string, tags []string) error { return v.Gauge(name, 1, tags, 1) },
+		"histogram":       func(name string, tags []string) error { return v.Histogram(name, time.Now(), tags, 1) },
+		"histogram value": func(name string, tags []string) error { return v.HistogramValue(name, 1, tags, 1) },
+	}
+	for kind, fn := range submit {
+		t.Run(kind, func(t *testing.T) {
+			m.Reset()
+			if err := fn("http-router", []string{"env:prod"}); !errors.Is(err, ErrInvalidMetricName) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidMetricName)
+			}
+			if points := m.Points("http-router"); len(points) != 0 {
+				t.Errorf("invalid metric submitted: %+v", points)
+			}
+
+			if err := fn("http_router", []string{"Env:prod", "2xx:true", "url:/a b"}); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			p, ok := m.Last("http_router")
+			if !ok || strings.Join(p.Tags, ",") != "env:prod,url:/a_b" {
+				t.Errorf("submitted %+v, want the normalized tags without the invalid one", p)
+			}
+
+			if got := m.Sum(ViolationMetric, "reason:invalid_name"); got != 1 {
+				t.Errorf("%s reason:invalid_name = %v, want 1", ViolationMetric, got)
+			}
+			if got := m.Sum(ViolationMetric, "reason:invalid_tag"); got != 1 {
+				t.Errorf("%s reason:invalid_tag = %v, want 1", ViolationMetric, got)
+			}
+		})
+	}
+}
+
+func TestFirstReport(t *testing.T) {
+	v := New(metrictest.New())
+	if !v.firstReport("a") || v.firstReport("a") {
+		t.Error("firstReport() is not true only the first time")
+	}
+	for i := 0; len(v.reported) < MaxReported; i++ {
+		v.firstReport(strings.Repeat("b", i+1))
+	}
+	// the full set is emptied so an offender is logged again
+	if !v.firstReport("c") || len(v.reported) != 1 || !v.firstReport("a") {
+		t.Errorf("reported = %d offenders, want the set emptied once full", len(v.reported))
+	}
+}
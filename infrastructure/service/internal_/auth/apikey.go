@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+// DefaultAPIKeyHeader carries the api key when none is configured
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+// APIKey authenticates a static api key sent in Header
+type APIKey struct {
+	Header string
+	// Keys maps the subject to its key
+	Keys map[string]string
+}
+
+// NewAPIKeyFromConfig init new api key authenticator, the keys are subject:key entries
+func NewAPIKeyFromConfig(cfg config.AuthConfig) (*APIKey, error) {
+	a := &APIKey{Header: cfg.APIKeyHeader, Keys: map[string]string{}}
+	if a.Header == "" {
+		a.Header = DefaultAPIKeyHeader
+	}
+	for _, entry := range cfg.APIKeys {
+		subject, key, err := splitPair(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Auth.APIKeys: %s", err)
+		}
+		a.Keys[subject] = key
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator
+func (a *APIKey) Authenticate(r *http.Request) (principal.Principal, error) {
+	key := r.Header.Get(a.Header)
+	if key == "" {
+		return principal.Principal{}, response.ErrRequiredToken
+	}
+	// every key is compared so the time taken does not tell which one matched
+	subject := ""
+	for s, k := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			subject = s
+		}
+	}
+	if subject == "" {
+		return principal.Principal{}, response.ErrInvalidToken
+	}
+	return principal.Principal{Subject: subject, Method: MethodAPIKey}, nil
+}
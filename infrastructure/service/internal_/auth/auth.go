@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+	log "github.com/sirupsen/logrus"
+)
+
+// Authentication methods
+const (
+	MethodAPIKey = "apikey"
+	MethodHMAC   = "hmac"
+	MethodJWT    = "jwt"
+)
+
+// Authenticator authenticates a request. It returns response.ErrRequiredToken when the
+// request carries no credentials for its method, so the next authenticator is tried,
+// and response.ErrInvalidToken, response.ErrSignatureMisMatch or response.ErrUnauthorized
+// when the credentials are rejected.
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal.Principal, error)
+}
+
+// Chain tries the authenticators in order, the first one finding credentials decides
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request) (principal.Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err == response.ErrRequiredToken {
+			continue
+		}
+		return p, err
+	}
+	return principal.Principal{}, response.ErrRequiredToken
+}
+
+// Guard authenticates the requests of every route but the excluded ones
+type Guard struct {
+	authenticator Authenticator
+	exclude       map[string]bool
+}
+
+// NewGuard init new guard, exclude lists the registered paths served without authentication
+func NewGuard(a Authenticator, exclude []string) *Guard {
+	g := &Guard{authenticator: a, exclude: map[string]bool{}}
+	for _, path := range exclude {
+		g.exclude[path] = true
+	}
+	return g
+}
+
+// NewGuardFromConfig init new guard from the [Auth] config section, nil when no method is enabled
+func NewGuardFromConfig(cfg config.AuthConfig) (*Guard, error) {
+	chain := Chain{}
+	for _, method := range cfg.Methods {
+		switch strings.ToLower(method) {
+		case MethodAPIKey:
+			a, err := NewAPIKeyFromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		case MethodHMAC:
+			a, err := NewHMACFromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		case MethodJWT:
+			a, err := NewJWTFromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		default:
+			return nil, fmt.Errorf("unknown auth method %s", method)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return NewGuard(chain, cfg.Exclude), nil
+}
+
+// Authenticate returns r carrying the principal in its context, r as is for an excluded
+// route or a nil guard
+func (g *Guard) Authenticate(r *http.Request, route string) (*http.Request, error) {
+	if g == nil || g.exclude[route] {
+		return r, nil
+	}
+	p, err := g.authenticator.Authenticate(r)
+	if err != nil {
+		log.WithFields(log.Fields{"Request-URI": r.URL.RequestURI(), "Error": err}).Debug("Authentication failed")
+		return r, err
+	}
+	return r.WithContext(principal.NewContext(r.Context(), p)), nil
+}
+
+// splitPair splits a "name:value" config entry
+func splitPair(entry string) (string, string, error) {
+	i := strings.Index(entry, ":")
+	if i <= 0 || i == len(entry)-1 {
+		return "", "", fmt.Errorf("invalid entry, expecting name:value")
+	}
+	return strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:]), nil
+}
+
+func seconds(s int, def time.Duration) time.Duration {
+	if s <= 0 {
+		return def
+	}
+	return time.Duration(s) * time.Second
+}
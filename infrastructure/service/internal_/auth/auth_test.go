@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	a, err := NewAPIKeyFromConfig(config.AuthConfig{APIKeys: []string{"alice:key-a", "bob: key-b "}})
+	if err != nil {
+		t.Fatalf("NewAPIKeyFromConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		header      string
+		key         string
+		wantSubject string
+		wantErr     error
+	}{
+		{"valid key", DefaultAPIKeyHeader, "key-a", "alice", nil},
+		{"trimmed key", DefaultAPIKeyHeader, "key-b", "bob", nil},
+		{"unknown key", DefaultAPIKeyHeader, "key-c", "", response.ErrInvalidToken},
+		{"key prefix", DefaultAPIKeyHeader, "key-", "", response.ErrInvalidToken},
+		{"no key", DefaultAPIKeyHeader, "", "", response.ErrRequiredToken},
+		{"other header", "X-Token", "key-a", "", response.ErrRequiredToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			if tt.key != "" {
+				r.Header.Set(tt.header, tt.key)
+			}
+			p, err := a.Authenticate(r)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", p.Subject, tt.wantSubject)
+			}
+			if err == nil && p.Method != MethodAPIKey {
+				t.Errorf("Method = %q, want %q", p.Method, MethodAPIKey)
+			}
+		})
+	}
+}
+
+func TestNewAPIKeyFromConfigInvalidEntry(t *testing.T) {
+	for _, entry := range []string{"alice", ":key", "alice:"} {
+		if _, err := NewAPIKeyFromConfig(config.AuthConfig{APIKeys: []string{entry}}); err == nil {
+			t.Errorf("NewAPIKeyFromConfig(%q) accepted the entry", entry)
+		}
+	}
+}
+
+// staticAuthenticator returns its principal and error
+type staticAuthenticator struct {
+	p   principal.Principal
+	err error
+}
+
+func (a staticAuthenticator) Authenticate(r *http.Request) (principal.Principal, error) {
+	return a.p, a.err
+}
+
+func TestChainAuthenticate(t *testing.T) {
+	skip := staticAuthenticator{err: response.ErrRequiredToken}
+	alice := staticAuthenticator{p: principal.Principal{Subject: "alice"}}
+	reject := staticAuthenticator{err: response.ErrInvalidToken}
+
+	tests := []struct {
+		name        string
+		chain       Chain
+		wantSubject string
+		wantErr     error
+	}{
+		{"empty", Chain{}, "", response.ErrRequiredToken},
+		{"no credentials", Chain{skip, skip}, "", response.ErrRequiredToken},
+		{"next is tried without credentials", Chain{skip, alice}, "alice", nil},
+		{"first finding credentials decides", Chain{reject, alice}, "", response.ErrInvalidToken},
+		{"later ones are not tried", Chain{alice, reject}, "alice", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.chain.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", p.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestGuardAuthenticate(t *testing.T) {
+	g := NewGuard(staticAuthenticator{err: response.ErrRequiredToken}, []string{"/version"})
+	tests := []struct {
+		name    string
+		guard   *Guard
+		route   string
+		wantErr error
+	}{
+		{"excluded route", g, "/version", nil},
+		{"guarded route", g, "/accounts", response.ErrRequiredToken},
+		{"nil guard", nil, "/accounts", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.guard.Authenticate(httptest.NewRequest(http.MethodGet, tt.route, nil), tt.route)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, ok := principal.FromContext(r.Context()); ok {
+				t.Error("request carries a principal without authentication")
+			}
+		})
+	}
+
+	g = NewGuard(staticAuthenticator{p: principal.Principal{Subject: "alice"}}, nil)
+	r, err := g.Authenticate(httptest.NewRequest(http.MethodGet, "/accounts", nil), "/accounts")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if p, ok := principal.FromContext(r.Context()); !ok || p.Subject != "alice" {
+		t.Errorf("principal = %+v, %v, want alice", p, ok)
+	}
+}
+
+func TestNewGuardFromConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.AuthConfig
+		wantGuard bool
+		wantErr   bool
+	}{
+		{"no method", config.AuthConfig{}, false, false},
+		{"apikey", config.AuthConfig{Methods: []string{"apikey"}, APIKeys: []string{"alice:key"}}, true, false},
+		{"case insensitive", config.AuthConfig{Methods: []string{"HMAC"}, HMACKeys: []string{"k1:secret"}}, true, false},
+		{"unknown method", config.AuthConfig{Methods: []string{"basic"}}, false, true},
+		{"invalid entry", config.AuthConfig{Methods: []string{"apikey"}, APIKeys: []string{"alice"}}, false, true},
+		{"missing jwks", config.AuthConfig{Methods: []string{"jwt"}, JWKSFile: "/nonexistent/jwks.json"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGuardFromConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewGuardFromConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if (g != nil) != tt.wantGuard {
+				t.Errorf("NewGuardFromConfig() guard = %v, want guard %v", g, tt.wantGuard)
+			}
+		})
+	}
+}
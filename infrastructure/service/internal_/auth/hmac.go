@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+// HMAC request headers
+const (
+	HeaderKeyID     = "X-Key-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// Defaults used when the config leaves them empty
+const (
+	DefaultHMACMaxSkew     = 5 * time.Minute
+	DefaultHMACMaxBodySize = 1 << 20
+)
+
+// HMAC authenticates requests signed with a shared secret. The signature is the hex
+// encoded HMAC-SHA256 of
+//
+//	<method>\n<request uri>\n<X-Timestamp>\n<body>
+//
+// sent in X-Signature, with the secret named by X-Key-Id. X-Timestamp is in unix
+// seconds and must be within MaxSkew of the server time. The body signed is read
+// up to MaxBodySize bytes, a larger one is rejected.
+type HMAC struct {
+	// Secrets maps the key id, used as subject, to its secret
+	Secrets     map[string]string
+	MaxSkew     time.Duration
+	MaxBodySize int64
+
+	now func() time.Time
+}
+
+// NewHMACFromConfig init new hmac authenticator, the keys are keyid:secret entries
+func NewHMACFromConfig(cfg config.AuthConfig) (*HMAC, error) {
+	a := &HMAC{
+		Secrets:     map[string]string{},
+		MaxSkew:     seconds(cfg.HMACMaxSkew, DefaultHMACMaxSkew),
+		MaxBodySize: cfg.HMACMaxBodySize,
+		now:         time.Now,
+	}
+	if a.MaxBodySize <= 0 {
+		a.MaxBodySize = DefaultHMACMaxBodySize
+	}
+	for _, entry := range cfg.HMACKeys {
+		keyID, secret, err := splitPair(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Auth.HMACKeys: %s", err)
+		}
+		a.Secrets[keyID] = secret
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator, the body is read and restored for the handler
+func (a *HMAC) Authenticate(r *http.Request) (principal.Principal, error) {
+	signature := r.Header.Get(HeaderSignature)
+	if signature == "" {
+		return principal.Principal{}, response.ErrRequiredToken
+	}
+
+	keyID := r.Header.Get(HeaderKeyID)
+	secret, ok := a.Secrets[keyID]
+	if !ok {
+		return principal.Principal{}, response.ErrUnauthorized
+	}
+
+	rawTimestamp := r.Header.Get(HeaderTimestamp)
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return principal.Principal{}, response.ErrSignatureMisMatch
+	}
+	skew := a.now().Sub(time.Unix(timestamp, 0))
+	if skew > a.MaxSkew || skew < -a.MaxSkew {
+		return principal.Principal{}, response.ErrSignatureMisMatch
+	}
+
+	body := []byte{}
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, a.MaxBodySize))
+		if err != nil {
+			return principal.Principal{}, response.ErrBadRequest
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := Sign(secret, r.Method, r.URL.RequestURI(), rawTimestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return principal.Principal{}, response.ErrSignatureMisMatch
+	}
+	return principal.Principal{Subject: keyID, Method: MethodHMAC}, nil
+}
+
+// Sign returns the hex encoded signature of a request, see HMAC
+func Sign(secret, method, requestURI, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		method string
+		uri    string
+		body   string
+		want   string
+	}{
+		// printf 'POST\n/accounts?x=1\n1600000000\n{}' | openssl dgst -sha256 -hmac secret
+		{"reference", "secret", http.MethodPost, "/accounts?x=1", "{}", "992222d5f96b1b6400449e2b417395f23e1cf4fecf671f9d433702f924bef226"},
+		{"other secret", "other", http.MethodPost, "/accounts?x=1", "{}", ""},
+		{"other method", "secret", http.MethodPut, "/accounts?x=1", "{}", ""},
+		{"other query", "secret", http.MethodPost, "/accounts?x=2", "{}", ""},
+		{"other body", "secret", http.MethodPost, "/accounts?x=1", "[]", ""},
+	}
+	reference := tests[0].want
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sign(tt.secret, tt.method, tt.uri, "1600000000", []byte(tt.body))
+			if tt.want != "" && got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+			if tt.want == "" && got == reference {
+				t.Error("Sign() ignores what differs from the reference")
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	a, err := NewHMACFromConfig(config.AuthConfig{HMACKeys: []string{"k1:secret"}, HMACMaxBodySize: 16})
+	if err != nil {
+		t.Fatalf("NewHMACFromConfig() error = %v", err)
+	}
+	a.now = func() time.Time { return now }
+
+	timestamp := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+	tests := []struct {
+		name      string
+		keyID     string
+		timestamp string
+		body      string
+		// signedBody is the body signed, the sent one when empty
+		signedBody string
+		signature  string
+		wantErr    error
+	}{
+		{name: "valid", keyID: "k1", timestamp: timestamp(0), body: `{"a":1}`},
+		{name: "valid without body", keyID: "k1", timestamp: timestamp(0)},
+		{name: "skew within the limit", keyID: "k1", timestamp: timestamp(-DefaultHMACMaxSkew)},
+		{name: "future within the limit", keyID: "k1", timestamp: timestamp(DefaultHMACMaxSkew)},
+		{name: "too old", keyID: "k1", timestamp: timestamp(-DefaultHMACMaxSkew - time.Second), wantErr: response.ErrSignatureMisMatch},
+		{name: "too far in the future", keyID: "k1", timestamp: timestamp(DefaultHMACMaxSkew + time.Second), wantErr: response.ErrSignatureMisMatch},
+		{name: "invalid timestamp", keyID: "k1", timestamp: "yesterday", wantErr: response.ErrSignatureMisMatch},
+		{name: "unknown key", keyID: "k2", timestamp: timestamp(0), wantErr: response.ErrUnauthorized},
+		{name: "tampered body", keyID: "k1", timestamp: timestamp(0), body: `{"a":2}`, signedBody: `{"a":1}`, wantErr: response.ErrSignatureMisMatch},
+		{name: "wrong signature", keyID: "k1", timestamp: timestamp(0), signature: "00", wantErr: response.ErrSignatureMisMatch},
+		{name: "body over the limit", keyID: "k1", timestamp: timestamp(0), body: strings.Repeat("a", 17), wantErr: response.ErrBadRequest},
+		{name: "body at the limit", keyID: "k1", timestamp: timestamp(0), body: strings.Repeat("a", 16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/accounts?x=1", strings.NewReader(tt.body))
+			signedBody := tt.signedBody
+			if signedBody == "" {
+				signedBody = tt.body
+			}
+			signature := tt.signature
+			if signature == "" {
+				signature = Sign("secret", r.Method, r.URL.RequestURI(), tt.timestamp, []byte(signedBody))
+			}
+			r.Header.Set(HeaderKeyID, tt.keyID)
+			r.Header.Set(HeaderTimestamp, tt.timestamp)
+			r.Header.Set(HeaderSignature, signature)
+
+			p, err := a.Authenticate(r)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Subject != tt.keyID || p.Method != MethodHMAC {
+				t.Errorf("principal = %+v, want subject %s with hmac", p, tt.keyID)
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != tt.body {
+				t.Errorf("restored body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticateWithoutSignature(t *testing.T) {
+	a, _ := NewHMACFromConfig(config.AuthConfig{HMACKeys: []string{"k1:secret"}})
+	if a.MaxBodySize != DefaultHMACMaxBodySize {
+		t.Errorf("MaxBodySize = %d, want %d", a.MaxBodySize, DefaultHMACMaxBodySize)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	r.Header.Set(HeaderKeyID, "k1")
+	if _, err := a.Authenticate(r); err != response.ErrRequiredToken {
+		t.Errorf("Authenticate() error = %v, want %v", err, response.ErrRequiredToken)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// jwk is a json web key, only the RSA and symmetric (oct) ones are supported
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA public key
+	N string `json:"n"`
+	E string `json:"e"`
+	// symmetric key
+	K string `json:"k"`
+}
+
+// Key is a verification key of JWKS
+type Key struct {
+	ID string
+	// Alg restricts the key to one algorithm when set
+	Alg    string
+	RSA    *rsa.PublicKey
+	Secret []byte
+}
+
+// JWKS is a set of verification keys
+type JWKS struct {
+	Keys []Key
+}
+
+// LoadJWKS reads a json web key set file, e.g. {"keys": [{"kty": "RSA", "kid": "k1", "n": "...", "e": "AQAB"}]}
+func LoadJWKS(fname string) (*JWKS, error) {
+	/* #nosec G304 */
+	raw, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(raw)
+}
+
+// ParseJWKS parses a json web key set, the keys used for encryption are skipped
+func ParseJWKS(raw []byte) (*JWKS, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	jwks := &JWKS{}
+	for i, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key := Key{ID: k.Kid, Alg: k.Alg}
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: invalid modulus: %s", i, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: invalid exponent: %s", i, err)
+			}
+			key.RSA = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: invalid secret: %s", i, err)
+			}
+			key.Secret = secret
+		default:
+			return nil, fmt.Errorf("key %d: unsupported key type %s", i, k.Kty)
+		}
+		jwks.Keys = append(jwks.Keys, key)
+	}
+	return jwks, nil
+}
+
+// find returns the key usable for alg, by id when the token names one
+func (s *JWKS) find(kid string, alg string) (Key, bool) {
+	for _, k := range s.Keys {
+		if kid != "" && k.ID != kid {
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		if (alg[:2] == "HS") != (k.Secret != nil) {
+			continue
+		}
+		return k, true
+	}
+	return Key{}, false
+}
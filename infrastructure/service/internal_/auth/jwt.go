@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // hash implementations used by the algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+// algorithms are the supported jwt signing algorithms
+var algorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// JWT authenticates a bearer token signed with HS256/384/512 or RS256/384/512 by
+// one of the keys of JWKS. The exp and nbf claims are checked, with Leeway, and so
+// are iss and aud when Issuer and Audience are set. The sub claim is the subject.
+// A token without exp never expires unless RequireExp is set.
+type JWT struct {
+	JWKS       *JWKS
+	Issuer     string
+	Audience   string
+	Leeway     time.Duration
+	RequireExp bool
+
+	now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// NewJWTFromConfig init new jwt authenticator with the keys of Auth.JWKSFile
+func NewJWTFromConfig(cfg config.AuthConfig) (*JWT, error) {
+	jwks, err := LoadJWKS(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	return &JWT{
+		JWKS:       jwks,
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		Leeway:     time.Duration(cfg.JWTLeeway) * time.Second,
+		RequireExp: cfg.JWTRequireExp,
+		now:        time.Now,
+	}, nil
+}
+
+// Authenticate implements Authenticator
+func (a *JWT) Authenticate(r *http.Request) (principal.Principal, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return principal.Principal{}, response.ErrRequiredToken
+	}
+
+	claims, err := a.verify(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+	if err != nil {
+		return principal.Principal{}, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	return principal.Principal{Subject: subject, Method: MethodJWT, Claims: claims}, nil
+}
+
+// verify checks the signature and the registered claims of token, then returns its claims
+func (a *JWT) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, response.ErrInvalidToken
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, response.ErrInvalidToken
+	}
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, response.ErrInvalidToken
+	}
+	key, ok := a.JWKS.find(header.Kid, header.Alg)
+	if !ok {
+		return nil, response.ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, response.ErrInvalidToken
+	}
+	if !verifySignature(hash, key, parts[0]+"."+parts[1], signature) {
+		return nil, response.ErrInvalidToken
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, response.ErrInvalidToken
+	}
+	if !a.validClaims(claims) {
+		return nil, response.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func verifySignature(hash crypto.Hash, key Key, signed string, signature []byte) bool {
+	if key.Secret != nil {
+		mac := hmac.New(hash.New, key.Secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	return rsa.VerifyPKCS1v15(key.RSA, hash, h.Sum(nil), signature) == nil
+}
+
+func (a *JWT) validClaims(claims map[string]interface{}) bool {
+	now := a.now()
+	exp, ok := numericDate(claims, "exp")
+	if !ok || (exp == nil && a.RequireExp) {
+		return false
+	}
+	if exp != nil && now.After(exp.Add(a.Leeway)) {
+		return false
+	}
+	nbf, ok := numericDate(claims, "nbf")
+	if !ok || (nbf != nil && now.Before(nbf.Add(-a.Leeway))) {
+		return false
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return false
+	}
+	if a.Audience != "" && !hasAudience(claims["aud"], a.Audience) {
+		return false
+	}
+	return true
+}
+
+// numericDate returns the time of the date claim name, nil when it is absent and false
+// when it is not a number
+func numericDate(claims map[string]interface{}, name string) (*time.Time, bool) {
+	raw, ok := claims[name]
+	if !ok {
+		return nil, true
+	}
+	seconds, ok := raw.(float64)
+	if !ok {
+		return nil, false
+	}
+	t := time.Unix(int64(seconds), 0)
+	return &t, true
+}
+
+// hasAudience checks the aud claim, a string or an array of strings
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
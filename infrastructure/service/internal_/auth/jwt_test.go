@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testRSAKey *rsa.PrivateKey
+)
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	if testRSAKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("rsa.GenerateKey() error = %v", err)
+		}
+		testRSAKey = key
+	}
+	return testRSAKey
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// signToken returns a jwt signed with the test secret for the HS algorithms, the test rsa key else
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	hash := algorithms[alg]
+	var signature []byte
+	if alg[:2] == "HS" {
+		mac := hmac.New(hash.New, testSecret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	} else {
+		h := hash.New()
+		h.Write([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey(t), hash, h.Sum(nil)); err != nil {
+			t.Fatalf("rsa.SignPKCS1v15() error = %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testJWKS(t *testing.T) []byte {
+	t.Helper()
+	pub := rsaKey(t).PublicKey
+	return []byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rs", "n": %q, "e": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(testSecret),
+		base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	))
+}
+
+func TestParseJWKS(t *testing.T) {
+	jwks, err := ParseJWKS(testJWKS(t))
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("ParseJWKS() kept %d keys, want 2 without the encryption one", len(jwks.Keys))
+	}
+	if jwks.Keys[1].RSA.E != rsaKey(t).PublicKey.E || jwks.Keys[1].RSA.N.Cmp(rsaKey(t).PublicKey.N) != 0 {
+		t.Error("ParseJWKS() decoded another rsa key")
+	}
+
+	for _, raw := range []string{
+		`{"keys": [{"kty": "EC", "kid": "ec"}]}`,
+		`{"keys": [{"kty": "oct", "k": "not base64!"}]}`,
+		`{"keys": [{"kty": "RSA", "n": "%%", "e": "AQAB"}]}`,
+		`not json`,
+	} {
+		if _, err := ParseJWKS([]byte(raw)); err == nil {
+			t.Errorf("ParseJWKS(%s) accepted the set", raw)
+		}
+	}
+}
+
+func TestJWKSFind(t *testing.T) {
+	jwks, err := ParseJWKS(testJWKS(t))
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		kid    string
+		alg    string
+		wantID string
+	}{
+		{"by id", "rs", "RS256", "rs"},
+		{"without id", "", "RS384", "rs"},
+		{"restricted alg", "hs", "HS256", "hs"},
+		{"other alg of a restricted key", "hs", "HS512", ""},
+		// a rsa public key must never be used as a hmac secret
+		{"hmac alg with a rsa key", "rs", "HS256", ""},
+		{"rsa alg with a secret", "hs", "RS256", ""},
+		{"unknown id", "k9", "RS256", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := jwks.find(tt.kid, tt.alg)
+			if ok != (tt.wantID != "") {
+				t.Fatalf("find() found = %v, want %v", ok, tt.wantID != "")
+			}
+			if key.ID != tt.wantID {
+				t.Errorf("find() = %s, want %s", key.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	jwks, err := ParseJWKS(testJWKS(t))
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	now := time.Unix(1600000000, 0)
+	at := func(d time.Duration) float64 {
+		return float64(now.Add(d).Unix())
+	}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": "ddogsvc", "exp": at(time.Minute)}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		alg        string
+		kid        string
+		claims     map[string]interface{}
+		requireExp bool
+		token      string
+		wantErr    error
+	}{
+		{name: "hs256", alg: "HS256", kid: "hs", claims: valid()},
+		{name: "rs256", alg: "RS256", kid: "rs", claims: valid()},
+		{name: "rs512", alg: "RS512", kid: "rs", claims: valid()},
+		{name: "expired", alg: "RS256", kid: "rs", claims: with("exp", at(-time.Minute)), wantErr: response.ErrInvalidToken},
+		{name: "expired within leeway", alg: "RS256", kid: "rs", claims: with("exp", at(-5*time.Second))},
+		{name: "exp not a number", alg: "RS256", kid: "rs", claims: with("exp", "tomorrow"), wantErr: response.ErrInvalidToken},
+		{name: "without exp", alg: "RS256", kid: "rs", claims: with("exp", nil)},
+		{name: "without exp when required", alg: "RS256", kid: "rs", claims: with("exp", nil), requireExp: true, wantErr: response.ErrInvalidToken},
+		{name: "with exp when required", alg: "RS256", kid: "rs", claims: valid(), requireExp: true},
+		{name: "not yet valid", alg: "RS256", kid: "rs", claims: with("nbf", at(time.Minute)), wantErr: response.ErrInvalidToken},
+		{name: "valid from now", alg: "RS256", kid: "rs", claims: with("nbf", at(0))},
+		{name: "other issuer", alg: "RS256", kid: "rs", claims: with("iss", "other"), wantErr: response.ErrInvalidToken},
+		{name: "audience list", alg: "RS256", kid: "rs", claims: with("aud", []string{"other", "ddogsvc"})},
+		{name: "other audience", alg: "RS256", kid: "rs", claims: with("aud", []string{"other"}), wantErr: response.ErrInvalidToken},
+		{name: "without audience", alg: "RS256", kid: "rs", claims: with("aud", nil), wantErr: response.ErrInvalidToken},
+		{name: "unsupported alg", token: encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, map[string]string{"sub": "alice"}) + ".", wantErr: response.ErrInvalidToken},
+		{name: "malformed", token: "abc.def", wantErr: response.ErrInvalidToken},
+		{name: "no bearer", token: "-", wantErr: response.ErrRequiredToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &JWT{
+				JWKS:       jwks,
+				Issuer:     "issuer",
+				Audience:   "ddogsvc",
+				Leeway:     10 * time.Second,
+				RequireExp: tt.requireExp,
+				now:        func() time.Time { return now },
+			}
+			token := tt.token
+			if token == "" {
+				token = signToken(t, tt.alg, tt.kid, tt.claims)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			if token != "-" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			p, err := a.Authenticate(r)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != "alice" || p.Method != MethodJWT || p.Claims["iss"] != "issuer") {
+				t.Errorf("principal = %+v, want alice with its claims", p)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticateTamperedSignature(t *testing.T) {
+	jwks, err := ParseJWKS(testJWKS(t))
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	a := &JWT{JWKS: jwks, now: time.Now}
+
+	token := signToken(t, "RS256", "rs", map[string]interface{}{"sub": "alice"})
+	forged := signToken(t, "RS256", "rs", map[string]interface{}{"sub": "mallory"})
+	// the claims of forged with the signature of token
+	parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+	r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	r.Header.Set("Authorization", "Bearer "+forgedParts[0]+"."+forgedParts[1]+"."+parts[2])
+	if _, err := a.Authenticate(r); err != response.ErrInvalidToken {
+		t.Errorf("Authenticate() error = %v, want %v", err, response.ErrInvalidToken)
+	}
+
+	// a token signed with HS256 using the rsa public key as secret
+	pub := jwks.Keys[1].RSA
+	signed := encodeSegment(t, map[string]string{"alg": "HS256", "kid": "rs"}) + "." + encodeSegment(t, map[string]string{"sub": "mallory"})
+	mac := hmac.New(crypto.SHA256.New, pub.N.Bytes())
+	mac.Write([]byte(signed))
+	r.Header.Set("Authorization", "Bearer "+signed+"."+base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	if _, err := a.Authenticate(r); err != response.ErrInvalidToken {
+		t.Errorf("Authenticate() error = %v with an algorithm confusion, want %v", err, response.ErrInvalidToken)
+	}
+}
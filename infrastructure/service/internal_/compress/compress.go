@@ -0,0 +1,248 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/sampling"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/accept"
+	log "github.com/sirupsen/logrus"
+)
+
+// Response size histograms in bytes, tagged with url_path and encoding:br, gzip or identity
+const (
+	SizeMetric             = "http_response.size"
+	UncompressedSizeMetric = "http_response.uncompressed_size"
+)
+
+// DefaultMinSize is used when the configured threshold is not positive
+const DefaultMinSize = 1024
+
+// Encoding is a content coding the responses can be compressed with
+type Encoding struct {
+	Name      string
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// Gzip and Brotli are the supported encodings, a level of 0 uses the encoding default
+var (
+	Gzip = Encoding{Name: "gzip", NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	}}
+	Brotli = Encoding{Name: "br", NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level), nil
+	}}
+)
+
+// EncodingByName returns the encoding named br or gzip
+func EncodingByName(name string) (Encoding, bool) {
+	switch strings.ToLower(name) {
+	case Brotli.Name:
+		return Brotli, true
+	case Gzip.Name:
+		return Gzip, true
+	}
+	return Encoding{}, false
+}
+
+// Options holds the compression settings
+type Options struct {
+	// Encodings in order of preference, no compression when empty
+	Encodings []Encoding
+	// MinSize is the response size in bytes from which it is compressed
+	MinSize int
+	Level   int
+	Metric  metric.MetricInterface
+	Sampler sampling.Policy
+}
+
+// Middleware compresses the responses of next with the preferred encoding accepted by
+// the client, once they reach MinSize bytes, and reports their size
+func Middleware(next http.Handler, o *Options) http.Handler {
+	minSize := o.MinSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{
+			ResponseWriter: w,
+			minSize:        minSize,
+			level:          o.Level,
+			status:         http.StatusOK,
+		}
+		if len(o.Encodings) > 0 {
+			w.Header().Add("Vary", "Accept-Encoding")
+			cw.encoding, cw.compress = negotiate(r.Header.Get("Accept-Encoding"), o.Encodings)
+		}
+
+		next.ServeHTTP(cw, r)
+		cw.Close()
+
+		route := r.Header.Get("routePath")
+		if route == "" {
+			route = "UNKNOWN"
+		}
+		rate := float64(1)
+		if o.Sampler != nil {
+			rate = o.Sampler.Rate(SizeMetric, route, sampling.IsErrorStatus(o.Sampler, cw.status))
+		}
+		tags := []string{
+			fmt.Sprintf("url_path:%s", route),
+			"encoding:" + cw.appliedEncoding(),
+		}
+		if err := o.Metric.HistogramValue(SizeMetric, float64(cw.written), tags, rate); err != nil {
+			log.Println("failed to submit the response size:", err)
+			return
+		}
+		if err := o.Metric.HistogramValue(UncompressedSizeMetric, float64(cw.uncompressed), tags, rate); err != nil {
+			log.Println("failed to submit the response size:", err)
+		}
+	})
+}
+
+// negotiate returns the encoding accepted with the highest quality, ties broken by the order of encodings
+func negotiate(acceptEncoding string, encodings []Encoding) (Encoding, bool) {
+	accepted := accept.Parse(acceptEncoding)
+	best, bestQ := Encoding{}, 0.0
+	for _, enc := range encodings {
+		q, ok := accept.Quality(accepted, enc.Name)
+		if !ok {
+			q, ok = accept.Quality(accepted, "*")
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// compressWriter holds the response back until it reaches minSize, then compresses it,
+// a smaller response is written as is on Close
+type compressWriter struct {
+	http.ResponseWriter
+	encoding Encoding
+	compress bool
+	minSize  int
+	level    int
+
+	status       int
+	buf          []byte
+	started      bool
+	writer       io.WriteCloser
+	written      int
+	uncompressed int
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started {
+		return
+	}
+	cw.status = status
+	// bodyless responses are not held back
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	cw.uncompressed += len(b)
+	if !cw.started {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		cw.start(cw.compress)
+		buf := cw.buf
+		cw.buf = nil
+		if _, err := cw.out().Write(buf); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return cw.out().Write(b)
+}
+
+// Flush sends what is held back, compressing it if the client accepts it whatever its size
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(cw.compress && len(cw.buf) > 0)
+		buf := cw.buf
+		cw.buf = nil
+		cw.out().Write(buf)
+	}
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes what is held back and ends the compressed stream
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		cw.start(false)
+		if len(cw.buf) > 0 {
+			buf := cw.buf
+			cw.buf = nil
+			cw.out().Write(buf)
+		}
+	}
+	if cw.writer != nil {
+		return cw.writer.Close()
+	}
+	return nil
+}
+
+// start writes the header, with the content encoding when compress is set
+func (cw *compressWriter) start(compress bool) {
+	cw.started = true
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding.Name)
+		writer, err := cw.encoding.NewWriter(countingWriter{cw}, cw.level)
+		if err == nil {
+			cw.writer = writer
+		} else {
+			h.Del("Content-Encoding")
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) out() io.Writer {
+	if cw.writer != nil {
+		return cw.writer
+	}
+	return countingWriter{cw}
+}
+
+func (cw *compressWriter) appliedEncoding() string {
+	if cw.writer != nil {
+		return cw.encoding.Name
+	}
+	return "identity"
+}
+
+// countingWriter writes to the underlying response writer, counting the bytes sent
+type countingWriter struct {
+	cw *compressWriter
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.cw.ResponseWriter.Write(b)
+	c.cw.written += n
+	return n, err
+}
@@ -0,0 +1,215 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+)
+
+func TestNegotiate(t *testing.T) {
+	both := []Encoding{Brotli, Gzip}
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		encodings      []Encoding
+		want           string
+	}{
+		{"none accepted", "", both, ""},
+		{"identity only", "identity", both, ""},
+		{"gzip", "gzip", both, "gzip"},
+		{"order of preference breaks ties", "gzip, br", both, "br"},
+		{"quality wins", "br;q=0.5, gzip", both, "gzip"},
+		{"case insensitive", "GZIP", both, "gzip"},
+		{"wildcard", "*", both, "br"},
+		{"explicit beats wildcard", "*;q=0.1, gzip;q=0.5", both, "gzip"},
+		{"refused", "br;q=0, gzip;q=0", both, ""},
+		{"not configured", "br", []Encoding{Gzip}, ""},
+		{"spaces", " gzip ; q=0.8 , br ; q=0.9", both, "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, ok := negotiate(tt.acceptEncoding, tt.encodings)
+			if ok != (tt.want != "") {
+				t.Fatalf("negotiate(%q) accepted = %v, want %v", tt.acceptEncoding, ok, tt.want != "")
+			}
+			if enc.Name != tt.want {
+				t.Errorf("negotiate(%q) = %s, want %s", tt.acceptEncoding, enc.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodingByName(t *testing.T) {
+	for _, name := range []string{"br", "BR", "gzip"} {
+		if _, ok := EncodingByName(name); !ok {
+			t.Errorf("EncodingByName(%s) not found", name)
+		}
+	}
+	if _, ok := EncodingByName("deflate"); ok {
+		t.Error("EncodingByName(deflate) found")
+	}
+}
+
+// decode returns the body of w decoded with its Content-Encoding
+func decode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body []byte
+	var err error
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		zr, zerr := gzip.NewReader(w.Body)
+		if zerr != nil {
+			t.Fatalf("gzip.NewReader() error = %v", zerr)
+		}
+		body, err = ioutil.ReadAll(zr)
+	case "br":
+		body, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+	default:
+		body, err = ioutil.ReadAll(w.Body)
+	}
+	if err != nil {
+		t.Fatalf("decoding the body: %v", err)
+	}
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		status         int
+		// writes are written one by one by the handler
+		writes       []string
+		wantEncoding string
+		wantSize     string
+	}{
+		{"below the threshold", "gzip", http.StatusOK, []string{"small"}, "", "identity"},
+		{"at the threshold", "gzip", http.StatusOK, []string{strings.Repeat("a", 1024)}, "gzip", "gzip"},
+		{"threshold reached over writes", "br", http.StatusOK, []string{strings.Repeat("a", 1000), strings.Repeat("b", 100)}, "br", "br"},
+		{"not accepted", "", http.StatusOK, []string{large}, "", "identity"},
+		{"error status", "gzip", http.StatusInternalServerError, []string{large}, "gzip", "gzip"},
+		{"no content", "gzip", http.StatusNoContent, nil, "", "identity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrictest.New()
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "1")
+				w.WriteHeader(tt.status)
+				for _, s := range tt.writes {
+					w.Write([]byte(s))
+				}
+			}), &Options{Encodings: []Encoding{Brotli, Gzip}, Metric: m})
+
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			r.Header.Set("routePath", "/accounts")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantEncoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Error("Content-Length is kept on a compressed response")
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			sent := w.Body.Len()
+			want := strings.Join(tt.writes, "")
+			if got := decode(t, w); got != want {
+				t.Errorf("body of %d bytes, want %d bytes", len(got), len(want))
+			}
+
+			uncompressed, _ := m.Last(UncompressedSizeMetric)
+			if uncompressed.Value != float64(len(want)) {
+				t.Errorf("%s = %v, want %d", UncompressedSizeMetric, uncompressed.Value, len(want))
+			}
+			size, _ := m.Last(SizeMetric)
+			if size.Value != float64(sent) {
+				t.Errorf("%s = %v, want %d", SizeMetric, size.Value, sent)
+			}
+			wantTags := []string{"url_path:/accounts", "encoding:" + tt.wantSize}
+			if strings.Join(size.Tags, ",") != strings.Join(wantTags, ",") {
+				t.Errorf("tags = %v, want %v", size.Tags, wantTags)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	m := metrictest.New()
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 4096)))
+	}), &Options{Metric: m})
+
+	r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("headers = %v, want no compression", w.Header())
+	}
+	if w.Body.Len() != 4096 {
+		t.Errorf("body of %d bytes, want 4096", w.Body.Len())
+	}
+	if _, ok := m.Last(SizeMetric, "url_path:UNKNOWN"); !ok {
+		t.Errorf("points = %v, want url_path:UNKNOWN without route", m.Points(SizeMetric))
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		// a flushed response is compressed whatever its size, it may be a stream
+		{"compressed below the threshold", "gzip", "gzip"},
+		{"not accepted", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var flushedEncoding string
+			var flushedBody int
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("event: 1\n\n"))
+				w.(http.Flusher).Flush()
+				rec := w.(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder)
+				flushedEncoding = rec.Header().Get("Content-Encoding")
+				flushedBody = rec.Body.Len()
+				w.Write([]byte("event: 2\n\n"))
+			}), &Options{Encodings: []Encoding{Gzip}, Metric: metrictest.New()})
+
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if flushedEncoding != tt.wantEncoding {
+				t.Errorf("Content-Encoding at flush = %q, want %q", flushedEncoding, tt.wantEncoding)
+			}
+			if flushedBody == 0 {
+				t.Error("nothing was sent on flush")
+			}
+			if !w.Flushed {
+				t.Error("the underlying writer was not flushed")
+			}
+			if got := decode(t, w); got != "event: 1\n\nevent: 2\n\n" {
+				t.Errorf("body = %q", got)
+			}
+		})
+	}
+}
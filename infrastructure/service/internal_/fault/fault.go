@@ -0,0 +1,55 @@
+package fault
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Fault is injected in the responses of the public endpoints. Rate is the share of the
+// requests failing with StatusCode, Latency in seconds is added to every request.
+type Fault struct {
+	StatusCode int     `json:"status_code"`
+	Rate       float64 `json:"rate"`
+	Latency    int     `json:"latency"`
+}
+
+// Controller holds the fault set at runtime, it is safe for concurrent use
+type Controller struct {
+	mu    sync.RWMutex
+	fault Fault
+}
+
+// New init new fault controller, no fault is injected until Set is called
+func New() *Controller {
+	return &Controller{}
+}
+
+// Get returns the current fault
+func (c *Controller) Get() Fault {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fault
+}
+
+// Set replaces the current fault
+func (c *Controller) Set(f Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fault = f
+}
+
+// Reset stops injecting faults
+func (c *Controller) Reset() {
+	c.Set(Fault{})
+}
+
+// Inject returns the status code, 0 when the request should not fail, and the latency
+// in seconds to apply to a request
+func (c *Controller) Inject() (statusCode int, latency int) {
+	f := c.Get()
+	/* #nosec G404 */
+	if f.StatusCode != 0 && rand.Float64() < f.Rate {
+		statusCode = f.StatusCode
+	}
+	return statusCode, f.Latency
+}
@@ -0,0 +1,259 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics reported by the limiter, tagged with url_path:<path> or url_path:all for the global limit
+const (
+	InFlightMetric = "limiter.in_flight"
+	QueuedMetric   = "limiter.queued"
+	ShedMetric     = "limiter.shed" // also tagged with reason:queue_full or reason:queue_timeout
+)
+
+// Defaults used when the config leaves them empty
+const (
+	DefaultQueueTimeout   = 100 * time.Millisecond
+	DefaultRetryAfter     = time.Second
+	DefaultReportInterval = 10 * time.Second
+)
+
+// Shedding errors, both mean the request should be retried later
+var (
+	ErrQueueFull    = errors.New("limiter queue is full")
+	ErrQueueTimeout = errors.New("limiter queue timeout")
+)
+
+// Options holds the limiter settings, a zero limit means unlimited
+type Options struct {
+	MaxInFlight int
+	// Routes caps the in-flight handlers of a route, the registered path including the prefix
+	Routes map[string]int
+	// MaxQueue is how many requests may wait for a slot, beyond it they are shed at once.
+	// It defaults to the largest of the limits, so a burst may queue as much as it runs.
+	MaxQueue       int
+	QueueTimeout   time.Duration
+	RetryAfter     time.Duration
+	ReportInterval time.Duration
+}
+
+// Limiter caps the concurrent in-flight handlers globally and per route. A request
+// over the limit waits in a bounded queue for a slot, up to the queue timeout.
+type Limiter struct {
+	metric   metric.MetricInterface
+	opt      Options
+	global   *pool
+	routes   map[string]*pool
+	queued   int64
+	interval time.Duration
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// pool is a counting semaphore, a nil pool is unlimited
+type pool struct {
+	name     string
+	slots    chan struct{}
+	inFlight int64
+	queued   int64
+}
+
+func newPool(name string, size int) *pool {
+	if size <= 0 {
+		return nil
+	}
+	return &pool{name: name, slots: make(chan struct{}, size)}
+}
+
+// New init new limiter
+func New(m metric.MetricInterface, o *Options) *Limiter {
+	l := &Limiter{
+		metric:   m,
+		opt:      *o,
+		global:   newPool("all", o.MaxInFlight),
+		routes:   map[string]*pool{},
+		interval: o.ReportInterval,
+		stop:     make(chan struct{}),
+	}
+	if l.opt.MaxQueue <= 0 {
+		l.opt.MaxQueue = defaultMaxQueue(o)
+	}
+	if l.opt.QueueTimeout <= 0 {
+		l.opt.QueueTimeout = DefaultQueueTimeout
+	}
+	if l.opt.RetryAfter <= 0 {
+		l.opt.RetryAfter = DefaultRetryAfter
+	}
+	if l.interval <= 0 {
+		l.interval = DefaultReportInterval
+	}
+	for route, size := range o.Routes {
+		if p := newPool(route, size); p != nil {
+			l.routes[route] = p
+		}
+	}
+	return l
+}
+
+// defaultMaxQueue returns the largest limit of o
+func defaultMaxQueue(o *Options) int {
+	max := o.MaxInFlight
+	for _, size := range o.Routes {
+		if size > max {
+			max = size
+		}
+	}
+	return max
+}
+
+// NewFromConfig init new limiter from the [Limiter] and [RouteLimit "name"] config sections
+func NewFromConfig(m metric.MetricInterface, cfg config.LimiterConfig, routes map[string]*config.RouteLimitConfig) *Limiter {
+	o := &Options{
+		MaxInFlight:  cfg.MaxInFlight,
+		Routes:       map[string]int{},
+		MaxQueue:     cfg.MaxQueue,
+		QueueTimeout: time.Duration(cfg.QueueTimeout) * time.Millisecond,
+		RetryAfter:   time.Duration(cfg.RetryAfter) * time.Second,
+	}
+	for _, r := range routes {
+		o.Routes[r.Route] = r.MaxInFlight
+	}
+	return New(m, o)
+}
+
+// RetryAfter is how long a shed client is asked to wait before retrying
+func (l *Limiter) RetryAfter() time.Duration {
+	return l.opt.RetryAfter
+}
+
+// Acquire takes a slot of route and a global one, waiting in the queue when they are all
+// taken. The returned release must be called once the handler is done. On ErrQueueFull or
+// ErrQueueTimeout the request is to be shed, a nil limiter never sheds.
+func (l *Limiter) Acquire(ctx context.Context, route string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	// the route slot is taken first so a request blocked on its route does not hold a global slot
+	pools := []*pool{l.routes[route], l.global}
+	taken := []*pool{}
+	release = func() {
+		for _, p := range taken {
+			atomic.AddInt64(&p.inFlight, -1)
+			<-p.slots
+		}
+	}
+
+	var timer *time.Timer
+	for _, p := range pools {
+		if p == nil {
+			continue
+		}
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			if timer == nil {
+				timer = time.NewTimer(l.opt.QueueTimeout)
+				defer timer.Stop()
+			}
+			if err := l.wait(ctx, p, timer); err != nil {
+				release()
+				l.shed(route, err)
+				return nil, err
+			}
+		}
+		atomic.AddInt64(&p.inFlight, 1)
+		taken = append(taken, p)
+	}
+	return release, nil
+}
+
+// wait queues for a slot of p until the timer fires or ctx is done
+func (l *Limiter) wait(ctx context.Context, p *pool, timer *time.Timer) error {
+	if atomic.AddInt64(&l.queued, 1) > int64(l.opt.MaxQueue) {
+		atomic.AddInt64(&l.queued, -1)
+		return ErrQueueFull
+	}
+	atomic.AddInt64(&p.queued, 1)
+	defer func() {
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&l.queued, -1)
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ErrQueueTimeout
+	}
+}
+
+func (l *Limiter) shed(route string, err error) {
+	reason := "queue_timeout"
+	if err == ErrQueueFull {
+		reason = "queue_full"
+	}
+	if err := l.metric.Count(ShedMetric, 1, []string{fmt.Sprintf("url_path:%s", route), "reason:" + reason}, 1); err != nil {
+		log.Println("failed to count the shed request:", err)
+	}
+}
+
+// Start reports the in-flight and queued gauges in background until Stop is called
+func (l *Limiter) Start() {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.report()
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops reporting
+func (l *Limiter) Stop() {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	l.wg.Wait()
+}
+
+func (l *Limiter) report() {
+	pools := []*pool{l.global}
+	for _, p := range l.routes {
+		pools = append(pools, p)
+	}
+	for _, p := range pools {
+		if p == nil {
+			continue
+		}
+		tags := []string{fmt.Sprintf("url_path:%s", p.name)}
+		if err := l.metric.Gauge(InFlightMetric, float64(atomic.LoadInt64(&p.inFlight)), tags, 1); err != nil {
+			log.Println("failed to report the limiter:", err)
+			return
+		}
+		if err := l.metric.Gauge(QueuedMetric, float64(atomic.LoadInt64(&p.queued)), tags, 1); err != nil {
+			log.Println("failed to report the limiter:", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package limiter
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+)
+
+// waitQueued waits until n requests are queued in l
+func waitQueued(t *testing.T, l *Limiter, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&l.queued) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", atomic.LoadInt64(&l.queued), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	m := metrictest.New()
+	l := New(m, &Options{MaxInFlight: 2})
+
+	releases := []func(){}
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(context.Background(), "/accounts")
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	l.report()
+	if p, ok := m.Last(InFlightMetric, "url_path:all"); !ok || p.Value != 2 {
+		t.Errorf("%s = %+v, want 2", InFlightMetric, p)
+	}
+
+	releases[0]()
+	release, err := l.Acquire(context.Background(), "/accounts")
+	if err != nil {
+		t.Fatalf("Acquire() after a release error = %v", err)
+	}
+	release()
+	releases[1]()
+
+	m.Reset()
+	l.report()
+	if p, ok := m.Last(InFlightMetric, "url_path:all"); !ok || p.Value != 0 {
+		t.Errorf("%s = %+v, want 0 once released", InFlightMetric, p)
+	}
+}
+
+func TestAcquireUnlimited(t *testing.T) {
+	var nilLimiter *Limiter
+	release, err := nilLimiter.Acquire(context.Background(), "/accounts")
+	if err != nil {
+		t.Fatalf("Acquire() of a nil limiter error = %v", err)
+	}
+	release()
+
+	l := New(metrictest.New(), &Options{Routes: map[string]int{"/slow": 0}})
+	for i := 0; i < 100; i++ {
+		if _, err := l.Acquire(context.Background(), "/slow"); err != nil {
+			t.Fatalf("Acquire() without limit error = %v", err)
+		}
+	}
+}
+
+func TestAcquireQueueFull(t *testing.T) {
+	m := metrictest.New()
+	l := New(m, &Options{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Second})
+
+	release, err := l.Acquire(context.Background(), "/accounts")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	queued := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background(), "/accounts")
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	waitQueued(t, l, 1)
+
+	if _, err := l.Acquire(context.Background(), "/accounts"); err != ErrQueueFull {
+		t.Errorf("Acquire() over the queue error = %v, want %v", err, ErrQueueFull)
+	}
+	if got := m.Sum(ShedMetric, "url_path:/accounts", "reason:queue_full"); got != 1 {
+		t.Errorf("%s reason:queue_full = %v, want 1", ShedMetric, got)
+	}
+
+	// the queued request takes the slot once released
+	release()
+	if err := <-queued; err != nil {
+		t.Errorf("queued Acquire() error = %v", err)
+	}
+}
+
+func TestAcquireQueueTimeout(t *testing.T) {
+	m := metrictest.New()
+	timeout := 20 * time.Millisecond
+	l := New(m, &Options{MaxInFlight: 1, QueueTimeout: timeout})
+	if _, err := l.Acquire(context.Background(), "/accounts"); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), "/accounts"); err != ErrQueueTimeout {
+		t.Errorf("Acquire() error = %v, want %v", err, ErrQueueTimeout)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Errorf("waited %s, want the queue timeout of %s", waited, timeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx, "/accounts"); err != ErrQueueTimeout {
+		t.Errorf("Acquire() with a done context error = %v, want %v", err, ErrQueueTimeout)
+	}
+	if got := m.Sum(ShedMetric, "url_path:/accounts", "reason:queue_timeout"); got != 2 {
+		t.Errorf("%s reason:queue_timeout = %v, want 2", ShedMetric, got)
+	}
+	if atomic.LoadInt64(&l.queued) != 0 {
+		t.Errorf("queued = %d after the timeouts, want 0", l.queued)
+	}
+}
+
+func TestAcquireRouteBeforeGlobal(t *testing.T) {
+	l := New(metrictest.New(), &Options{MaxInFlight: 2, Routes: map[string]int{"/slow": 1}, QueueTimeout: time.Second})
+
+	releaseSlow, err := l.Acquire(context.Background(), "/slow")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	queued := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background(), "/slow")
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	waitQueued(t, l, 1)
+
+	// the request waiting for its route holds no global slot
+	if got := atomic.LoadInt64(&l.global.inFlight); got != 1 {
+		t.Errorf("global in flight = %d while a /slow request waits, want 1", got)
+	}
+	if got := atomic.LoadInt64(&l.routes["/slow"].queued); got != 1 {
+		t.Errorf("/slow queued = %d, want 1", got)
+	}
+	releaseFast, err := l.Acquire(context.Background(), "/fast")
+	if err != nil {
+		t.Fatalf("Acquire() of another route error = %v", err)
+	}
+
+	releaseFast()
+	releaseSlow()
+	if err := <-queued; err != nil {
+		t.Errorf("queued Acquire() error = %v", err)
+	}
+	if got := atomic.LoadInt64(&l.global.inFlight); got != 0 {
+		t.Errorf("global in flight = %d once released, want 0", got)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	l := New(metrictest.New(), &Options{MaxInFlight: 4, Routes: map[string]int{"/a": 8, "/b": 2}})
+	if l.opt.MaxQueue != 8 {
+		t.Errorf("MaxQueue = %d, want the largest limit 8", l.opt.MaxQueue)
+	}
+	if l.opt.QueueTimeout != DefaultQueueTimeout || l.RetryAfter() != DefaultRetryAfter {
+		t.Errorf("QueueTimeout = %s, RetryAfter = %s, want the defaults", l.opt.QueueTimeout, l.RetryAfter())
+	}
+}
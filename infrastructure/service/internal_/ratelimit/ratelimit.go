@@ -0,0 +1,251 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+	log "github.com/sirupsen/logrus"
+)
+
+// DecisionMetric counts the requests checked, tagged with group:<name> and decision:allowed or decision:limited
+const DecisionMetric = "ratelimit.decision"
+
+// Response headers
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+)
+
+// KeyFunc returns the client key of a request, the requests of a key share a bucket
+type KeyFunc func(r *http.Request) string
+
+// ClientIP keys by the address of the connection
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedIP keys by the first address of X-Forwarded-For, only use it behind a proxy setting it
+func ForwardedIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return ClientIP(r)
+}
+
+// Header keys the requests authenticated with the credential of header, e.g. X-Api-Key, by
+// their principal, falling back to the client ip. The raw value is never used, so a client
+// cannot pick its bucket by sending an unauthenticated one.
+func Header(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if r.Header.Get(name) == "" {
+			return ClientIP(r)
+		}
+		return Subject(r)
+	}
+}
+
+// Subject keys by the authenticated subject, falling back to the client ip
+func Subject(r *http.Request) string {
+	if p, ok := principal.FromContext(r.Context()); ok && p.Subject != "" {
+		return "subject:" + p.Subject
+	}
+	return ClientIP(r)
+}
+
+// KeyFuncByName returns the KeyFunc named ip, forwarded_ip, subject or header:<Name>
+func KeyFuncByName(name string) (KeyFunc, bool) {
+	switch {
+	case name == "" || name == "ip":
+		return ClientIP, true
+	case name == "forwarded_ip":
+		return ForwardedIP, true
+	case name == "subject":
+		return Subject, true
+	case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+		return Header(strings.TrimPrefix(name, "header:")), true
+	}
+	return nil, false
+}
+
+// Rule limits a group of routes, the ones starting with Prefix. The rules keyed by the
+// authenticated caller, e.g. by Subject, set Authenticated: Allow applies Limit to them
+// once the request is authenticated, and AllowClient applies ClientLimit per client ip
+// before, so the failed authentications are limited too. AllowClient applies the others.
+type Rule struct {
+	Name          string
+	Prefix        string
+	Key           KeyFunc
+	Limit         Limit
+	Authenticated bool
+	// ClientLimit defaults to Limit
+	ClientLimit Limit
+}
+
+// Options holds the rate limiter settings
+type Options struct {
+	Rules []Rule
+	// Store holds the buckets, a MemoryStore when nil
+	Store Store
+}
+
+// failureLogInterval is how often a failing store is logged
+const failureLogInterval = time.Minute
+
+// Limiter rate limits the requests of every client key with a token bucket,
+// the rule with the longest matching prefix applies
+type Limiter struct {
+	metric metric.MetricInterface
+	store  Store
+	rules  []Rule
+
+	// lastFailureLog is the unix nano time of the last failure logged
+	lastFailureLog int64
+}
+
+// New init new rate limiter
+func New(m metric.MetricInterface, o *Options) *Limiter {
+	store := o.Store
+	if store == nil {
+		store = NewMemoryStore(nil)
+	}
+	rules := append([]Rule{}, o.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+	for i := range rules {
+		if rules[i].Key == nil {
+			rules[i].Key = ClientIP
+		}
+		if rules[i].ClientLimit.Rate <= 0 {
+			rules[i].ClientLimit = rules[i].Limit
+		}
+		rules[i].Limit = defaultBurst(rules[i].Limit)
+		rules[i].ClientLimit = defaultBurst(rules[i].ClientLimit)
+	}
+	return &Limiter{metric: m, store: store, rules: rules}
+}
+
+// defaultBurst returns l with its burst defaulting to the rate rounded up
+func defaultBurst(l Limit) Limit {
+	if l.Burst <= 0 {
+		l.Burst = int(math.Max(1, math.Ceil(l.Rate)))
+	}
+	return l
+}
+
+// NewFromConfig init new rate limiter from the [RateLimit "name"] config sections
+func NewFromConfig(m metric.MetricInterface, cfg map[string]*config.RateLimitConfig, store Store) *Limiter {
+	o := &Options{Store: store}
+	for name, c := range cfg {
+		key, ok := KeyFuncByName(c.Key)
+		if !ok {
+			log.Printf("rate limit %s: unknown key %s, using the client ip", name, c.Key)
+			key = ClientIP
+		}
+		o.Rules = append(o.Rules, Rule{
+			Name:          name,
+			Prefix:        c.Prefix,
+			Key:           key,
+			Limit:         Limit{Rate: c.Rate, Burst: c.Burst},
+			Authenticated: ok && (c.Key == "subject" || strings.HasPrefix(c.Key, "header:")),
+			ClientLimit:   Limit{Rate: c.ClientRate, Burst: c.ClientBurst},
+		})
+	}
+	return New(m, o)
+}
+
+// AllowClient takes a token for the request to route before it is authenticated, from
+// the bucket of its client ip for an Authenticated rule. It returns false when no rule
+// applies, a store failure lets the request through.
+func (l *Limiter) AllowClient(r *http.Request, route string) (Result, bool) {
+	if l == nil {
+		return Result{}, false
+	}
+	rule, ok := l.match(route)
+	if !ok {
+		return Result{}, false
+	}
+	if rule.Authenticated {
+		return l.take(r, rule, "client:"+ClientIP(r), rule.ClientLimit)
+	}
+	return l.take(r, rule, rule.Key(r), rule.Limit)
+}
+
+// Allow takes a token for the authenticated request to route, it returns false when no
+// Authenticated rule applies. A store failure lets the request through.
+func (l *Limiter) Allow(r *http.Request, route string) (Result, bool) {
+	if l == nil {
+		return Result{}, false
+	}
+	rule, ok := l.match(route)
+	if !ok || !rule.Authenticated {
+		return Result{}, false
+	}
+	return l.take(r, rule, rule.Key(r), rule.Limit)
+}
+
+func (l *Limiter) take(r *http.Request, rule Rule, key string, limit Limit) (Result, bool) {
+	res, err := l.store.Take(r.Context(), rule.Name+":"+key, limit)
+	if err != nil {
+		l.logFailure("rate limit store failed, allowing the request:", err)
+		return Result{}, false
+	}
+
+	decision := "allowed"
+	if !res.Allowed {
+		decision = "limited"
+	}
+	if err := l.metric.Count(DecisionMetric, 1, []string{fmt.Sprintf("group:%s", rule.Name), "decision:" + decision}, 1); err != nil {
+		l.logFailure("failed to count the rate limit decision:", err)
+	}
+	return res, true
+}
+
+// logFailure logs at most once per failureLogInterval, a failing store would log every request
+func (l *Limiter) logFailure(msg string, err error) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&l.lastFailureLog)
+	if now-last < int64(failureLogInterval) || !atomic.CompareAndSwapInt64(&l.lastFailureLog, last, now) {
+		return
+	}
+	log.Println(msg, err)
+}
+
+func (l *Limiter) match(route string) (Rule, bool) {
+	for _, rule := range l.rules {
+		if strings.HasPrefix(route, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// SetHeaders sets the X-RateLimit-* headers, plus Retry-After when the request is limited.
+// Durations are in seconds, rounded up.
+func (res Result) SetHeaders(h http.Header) {
+	h.Set(HeaderLimit, strconv.Itoa(res.Limit))
+	h.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+	h.Set(HeaderReset, strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/principal"
+)
+
+// failingStore fails every take
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("store down")
+}
+
+func newRequest(remoteAddr string, header http.Header, p *principal.Principal) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	r.RemoteAddr = remoteAddr
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if p != nil {
+		r = r.WithContext(principal.NewContext(r.Context(), *p))
+	}
+	return r
+}
+
+func TestKeyFuncs(t *testing.T) {
+	alice := &principal.Principal{Subject: "alice", Method: "apikey"}
+	tests := []struct {
+		name      string
+		key       string
+		request   *http.Request
+		wantKey   string
+		wantFound bool
+	}{
+		{"ip by default", "", newRequest("10.0.0.1:1234", nil, nil), "10.0.0.1", true},
+		{"ip", "ip", newRequest("10.0.0.1:1234", nil, nil), "10.0.0.1", true},
+		{"forwarded ip", "forwarded_ip", newRequest("10.0.0.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1, 10.0.0.2"}}, nil), "192.0.2.1", true},
+		{"forwarded ip without header", "forwarded_ip", newRequest("10.0.0.1:1234", nil, nil), "10.0.0.1", true},
+		{"subject", "subject", newRequest("10.0.0.1:1234", nil, alice), "subject:alice", true},
+		{"subject unauthenticated", "subject", newRequest("10.0.0.1:1234", nil, nil), "10.0.0.1", true},
+		{"header authenticated", "header:X-Api-Key", newRequest("10.0.0.1:1234", http.Header{"X-Api-Key": {"secret"}}, alice), "subject:alice", true},
+		{"header unauthenticated", "header:X-Api-Key", newRequest("10.0.0.1:1234", http.Header{"X-Api-Key": {"guess"}}, nil), "10.0.0.1", true},
+		{"header missing", "header:X-Api-Key", newRequest("10.0.0.1:1234", nil, alice), "10.0.0.1", true},
+		{"header without name", "header:", nil, "", false},
+		{"unknown", "cookie", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, found := KeyFuncByName(tt.key)
+			if found != tt.wantFound {
+				t.Fatalf("KeyFuncByName(%q) found = %v, want %v", tt.key, found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if got := fn(tt.request); got != tt.wantKey {
+				t.Errorf("key = %q, want %q", got, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLimiterAllowClient(t *testing.T) {
+	m := metrictest.New()
+	l := New(m, &Options{Rules: []Rule{
+		{Name: "all", Prefix: "/", Limit: Limit{Rate: 1, Burst: 2}},
+		{Name: "accounts", Prefix: "/accounts", Limit: Limit{Rate: 1, Burst: 1}},
+		{Name: "default_burst", Prefix: "/customers", Limit: Limit{Rate: 2.5}},
+	}})
+
+	tests := []struct {
+		name      string
+		route     string
+		wantRule  bool
+		wantAllow bool
+		wantLimit int
+	}{
+		{"longest prefix", "/accounts", true, true, 1},
+		{"longest prefix limited", "/accounts", true, false, 1},
+		{"shorter prefix", "/version", true, true, 2},
+		{"burst defaults to the rate rounded up", "/customers", true, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := l.AllowClient(newRequest("10.0.0.1:1234", nil, nil), tt.route)
+			if ok != tt.wantRule {
+				t.Fatalf("AllowClient() rule found = %v, want %v", ok, tt.wantRule)
+			}
+			if res.Allowed != tt.wantAllow {
+				t.Errorf("Allowed = %v, want %v", res.Allowed, tt.wantAllow)
+			}
+			if res.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", res.Limit, tt.wantLimit)
+			}
+		})
+	}
+
+	if got := m.Sum(DecisionMetric, "decision:limited"); got != 1 {
+		t.Errorf("limited decisions = %v, want 1", got)
+	}
+	if got := m.Sum(DecisionMetric, "decision:allowed"); got != 3 {
+		t.Errorf("allowed decisions = %v, want 3", got)
+	}
+}
+
+func TestLimiterAllowAuthenticated(t *testing.T) {
+	l := New(metrictest.New(), &Options{Rules: []Rule{{
+		Name:          "partners",
+		Prefix:        "/",
+		Key:           Subject,
+		Limit:         Limit{Rate: 1, Burst: 1},
+		Authenticated: true,
+		ClientLimit:   Limit{Rate: 1, Burst: 2},
+	}}})
+	alice := &principal.Principal{Subject: "alice"}
+	bob := &principal.Principal{Subject: "bob"}
+
+	tests := []struct {
+		name      string
+		before    bool
+		principal *principal.Principal
+		wantAllow bool
+		wantLimit int
+	}{
+		{"client ip before authentication", true, nil, true, 2},
+		{"subject after authentication", false, alice, true, 1},
+		{"subject limited", false, alice, false, 1},
+		{"other subject", false, bob, true, 1},
+		{"client ip shared by the failed authentications", true, nil, true, 2},
+		{"client ip limited", true, nil, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest("10.0.0.1:1234", nil, tt.principal)
+			allow := l.Allow
+			if tt.before {
+				allow = l.AllowClient
+			}
+			res, ok := allow(r, "/accounts")
+			if !ok {
+				t.Fatal("no rule applied")
+			}
+			if res.Allowed != tt.wantAllow {
+				t.Errorf("Allowed = %v, want %v", res.Allowed, tt.wantAllow)
+			}
+			if res.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", res.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestLimiterWithoutRule(t *testing.T) {
+	l := New(metrictest.New(), &Options{Rules: []Rule{{Name: "admin", Prefix: "/admin", Limit: Limit{Rate: 1}}}})
+	if _, ok := l.AllowClient(newRequest("10.0.0.1:1234", nil, nil), "/accounts"); ok {
+		t.Error("AllowClient() applied a rule to an unmatched route")
+	}
+	if _, ok := l.Allow(newRequest("10.0.0.1:1234", nil, nil), "/admin"); ok {
+		t.Error("Allow() applied a rule keyed by the client ip after authentication")
+	}
+
+	var nilLimiter *Limiter
+	if _, ok := nilLimiter.AllowClient(newRequest("10.0.0.1:1234", nil, nil), "/accounts"); ok {
+		t.Error("AllowClient() of a nil limiter applied a rule")
+	}
+	if _, ok := nilLimiter.Allow(newRequest("10.0.0.1:1234", nil, nil), "/accounts"); ok {
+		t.Error("Allow() of a nil limiter applied a rule")
+	}
+}
+
+func TestLimiterAllowStoreFailure(t *testing.T) {
+	l := New(metrictest.New(), &Options{Store: failingStore{}, Rules: []Rule{{Name: "all", Prefix: "/", Limit: Limit{Rate: 1}}}})
+	for i := 0; i < 3; i++ {
+		if _, ok := l.AllowClient(newRequest("10.0.0.1:1234", nil, nil), "/accounts"); ok {
+			t.Fatal("AllowClient() applied a rule with a failing store")
+		}
+	}
+}
+
+func TestResultSetHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Result
+		want map[string]string
+	}{
+		{
+			name: "allowed",
+			res:  Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 100 * time.Millisecond},
+			want: map[string]string{HeaderLimit: "10", HeaderRemaining: "9", HeaderReset: "1", "Retry-After": ""},
+		},
+		{
+			name: "limited",
+			res:  Result{Limit: 10, RetryAfter: 1500 * time.Millisecond, Reset: 10 * time.Second},
+			want: map[string]string{HeaderLimit: "10", HeaderRemaining: "0", HeaderReset: "10", "Retry-After": "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			tt.res.SetHeaders(h)
+			for name, want := range tt.want {
+				if got := h.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second, holding up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a token is available, zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store holds the buckets. Take must be atomic per key, a store shared by the
+// instances of the service makes the limit apply to all of them together.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// memoryIdleTTL is how long an untouched bucket is kept by MemoryStore
+const memoryIdleTTL = 10 * time.Minute
+
+// DefaultMaxKeys is used when MemoryOptions.MaxKeys is not positive
+const DefaultMaxKeys = 100000
+
+// MemoryOptions holds the in-memory store settings
+type MemoryOptions struct {
+	// MaxKeys caps the buckets kept, a new key evicts an arbitrary bucket beyond it
+	MaxKeys int
+}
+
+// MemoryStore keeps the buckets in memory, the limit applies per instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	maxKeys   int
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryStore init new in-memory store, o may be nil for the defaults
+func NewMemoryStore(o *MemoryOptions) *MemoryStore {
+	s := &MemoryStore{
+		buckets:   map[string]*bucket{},
+		maxKeys:   DefaultMaxKeys,
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+	if o != nil && o.MaxKeys > 0 {
+		s.maxKeys = o.MaxKeys
+	}
+	return s
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	burst := float64(limit.Burst)
+	b, ok := s.buckets[key]
+	if !ok {
+		s.evict()
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	return res, nil
+}
+
+// sweep drops the idle buckets once in a while, a dropped bucket is recreated full
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryIdleTTL {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > memoryIdleTTL {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// evict drops an arbitrary bucket when the store is full, the map order being random
+// a client cannot tell which one
+func (s *MemoryStore) evict() {
+	if len(s.buckets) < s.maxKeys {
+		return
+	}
+	for key := range s.buckets {
+		delete(s.buckets, key)
+		return
+	}
+}
+
+// Len returns the number of buckets kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
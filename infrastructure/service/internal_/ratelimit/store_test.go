@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the store
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestStore(o *MemoryOptions) (*MemoryStore, *clock) {
+	c := &clock{t: time.Unix(1600000000, 0)}
+	s := NewMemoryStore(o)
+	s.now = c.now
+	s.lastSweep = c.t
+	return s, c
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	tests := []struct {
+		name string
+		// wait is how long to wait before each take
+		wait       []time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}{
+		{
+			name:      "first take starts full",
+			wait:      []time.Duration{0},
+			allowed:   true,
+			remaining: 2,
+			reset:     500 * time.Millisecond,
+		},
+		{
+			name:      "burst is consumed",
+			wait:      []time.Duration{0, 0, 0},
+			allowed:   true,
+			remaining: 0,
+			reset:     1500 * time.Millisecond,
+		},
+		{
+			name:       "over the burst is limited",
+			wait:       []time.Duration{0, 0, 0, 0},
+			allowed:    false,
+			remaining:  0,
+			retryAfter: 500 * time.Millisecond,
+			reset:      1500 * time.Millisecond,
+		},
+		{
+			name:       "partial refill is not enough",
+			wait:       []time.Duration{0, 0, 0, 250 * time.Millisecond},
+			allowed:    false,
+			remaining:  0,
+			retryAfter: 250 * time.Millisecond,
+			reset:      1250 * time.Millisecond,
+		},
+		{
+			name:      "refill at rate",
+			wait:      []time.Duration{0, 0, 0, 500 * time.Millisecond},
+			allowed:   true,
+			remaining: 0,
+			reset:     1500 * time.Millisecond,
+		},
+		{
+			name:      "refill stops at the burst",
+			wait:      []time.Duration{0, 0, 0, time.Hour},
+			allowed:   true,
+			remaining: 2,
+			reset:     500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestStore(nil)
+			var res Result
+			for _, wait := range tt.wait {
+				c.advance(wait)
+				var err error
+				if res, err = s.Take(context.Background(), "k", limit); err != nil {
+					t.Fatalf("Take() error = %v", err)
+				}
+			}
+			if res.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v", res.Allowed, tt.allowed)
+			}
+			if res.Limit != limit.Burst {
+				t.Errorf("Limit = %d, want %d", res.Limit, limit.Burst)
+			}
+			if res.Remaining != tt.remaining {
+				t.Errorf("Remaining = %d, want %d", res.Remaining, tt.remaining)
+			}
+			if res.RetryAfter != tt.retryAfter {
+				t.Errorf("RetryAfter = %s, want %s", res.RetryAfter, tt.retryAfter)
+			}
+			if res.Reset != tt.reset {
+				t.Errorf("Reset = %s, want %s", res.Reset, tt.reset)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	s, _ := newTestStore(nil)
+	limit := Limit{Rate: 1, Burst: 1}
+	if res, _ := s.Take(context.Background(), "a", limit); !res.Allowed {
+		t.Fatal("first take of a is limited")
+	}
+	if res, _ := s.Take(context.Background(), "a", limit); res.Allowed {
+		t.Fatal("second take of a is allowed")
+	}
+	if res, _ := s.Take(context.Background(), "b", limit); !res.Allowed {
+		t.Fatal("first take of b is limited")
+	}
+}
+
+func TestMemoryStoreMaxKeys(t *testing.T) {
+	s, _ := newTestStore(&MemoryOptions{MaxKeys: 3})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := s.Take(context.Background(), key, Limit{Rate: 1, Burst: 1}); err != nil {
+			t.Fatalf("Take(%s) error = %v", key, err)
+		}
+		if s.Len() > 3 {
+			t.Fatalf("Len() = %d after %s, want at most 3", s.Len(), key)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, c := newTestStore(nil)
+	limit := Limit{Rate: 1, Burst: 1}
+	s.Take(context.Background(), "idle", limit)
+	c.advance(memoryIdleTTL + time.Second)
+	s.Take(context.Background(), "active", limit)
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d after the sweep, want 1", s.Len())
+	}
+}
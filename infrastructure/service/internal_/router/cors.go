@@ -0,0 +1,128 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCORSMethods are allowed when CORSOptions.AllowedMethods is empty
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// CORSOptions holds the cross-origin settings. An origin may hold one * wildcard,
+// e.g. https://*.example.com, and a single * allows any origin. A single * in
+// AllowedHeaders allows whatever headers the preflight asks for.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // in seconds
+}
+
+type cors struct {
+	opt     CORSOptions
+	methods string
+	headers string
+	exposed string
+}
+
+func newCORS(o *CORSOptions) *cors {
+	c := &cors{opt: *o}
+	if len(c.opt.AllowedMethods) == 0 {
+		c.opt.AllowedMethods = DefaultCORSMethods
+	}
+	c.methods = strings.ToUpper(strings.Join(c.opt.AllowedMethods, ", "))
+	c.headers = strings.Join(c.opt.AllowedHeaders, ", ")
+	c.exposed = strings.Join(c.opt.ExposedHeaders, ", ")
+	return c
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin, empty when not allowed.
+// Any origin is answered with *, which the browsers never send credentials to.
+func (c *cors) allowedOrigin(origin string) string {
+	for _, allowed := range c.opt.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if matchOrigin(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchOrigin matches origin against pattern holding at most one * wildcard
+func matchOrigin(pattern, origin string) bool {
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return strings.EqualFold(pattern, origin)
+	}
+	prefix, suffix := strings.ToLower(pattern[:i]), strings.ToLower(pattern[i+1:])
+	origin = strings.ToLower(origin)
+	return len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func (c *cors) allowedMethod(method string) bool {
+	for _, m := range c.opt.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// setHeaders sets the headers of an actual cross-origin request, it returns false when
+// the origin is not allowed or the request is not cross-origin. Vary is set either way
+// so a cache does not serve the response of a request to another origin.
+func (c *cors) setHeaders(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	allowed := c.allowedOrigin(origin)
+	if allowed == "" {
+		return false
+	}
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if c.opt.AllowCredentials && allowed != "*" {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", c.exposed)
+	}
+	return true
+}
+
+// preflight answers the OPTIONS requests of the routes of the router, the Allow header
+// is already set with the methods registered for the path
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	method := r.Header.Get("Access-Control-Request-Method")
+	if method == "" || !c.setHeaders(w, r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !c.allowedMethod(method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.Set("Access-Control-Allow-Methods", c.methods)
+	if c.headers == "*" {
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+	} else if c.headers != "" {
+		h.Set("Access-Control-Allow-Headers", c.headers)
+	}
+	if c.opt.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(c.opt.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+	"github.com/julienschmidt/httprouter"
+)
+
+// corsRouter returns a router with GET and POST /v1/accounts allowing cross-origin requests by o
+func corsRouter(o *CORSOptions) *httprouter.Router {
+	hr := httprouter.New()
+	mr := New(&Options{Prefix: "/v1", Timeout: 1, Router: hr, CORS: o})
+	handle := func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+		return response.NewJSONResponse().SetData("ok")
+	}
+	mr.GET("/accounts", handle)
+	mr.POST("/accounts", handle)
+	return hr
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "HTTPS://Example.com", true},
+		{"https://example.com", "https://example.com.evil.io", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"http://localhost:*", "http://localhost:3000", true},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	hr := corsRouter(&CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		ExposedHeaders:   []string{"X-Request-Id", "Retry-After"},
+		AllowCredentials: true,
+	})
+
+	tests := []struct {
+		name            string
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+		wantExposed     string
+	}{
+		{"allowed", "https://app.example.com", "https://app.example.com", "true", "X-Request-Id, Retry-After"},
+		{"not allowed", "https://evil.io", "", "", ""},
+		{"same origin", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/accounts", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			hr.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			h := w.Header()
+			if h.Get("Access-Control-Allow-Origin") != tt.wantOrigin ||
+				h.Get("Access-Control-Allow-Credentials") != tt.wantCredentials ||
+				h.Get("Access-Control-Expose-Headers") != tt.wantExposed {
+				t.Errorf("headers = %v, want origin %q, credentials %q and exposed %q", h, tt.wantOrigin, tt.wantCredentials, tt.wantExposed)
+			}
+			if h.Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin whatever the origin", h.Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CORSOptions
+		origin  string
+		method  string
+		headers string
+		// want are the response headers, empty values must be absent
+		want map[string]string
+	}{
+		{
+			name:    "allowed",
+			options: CORSOptions{AllowedOrigins: []string{"https://app.example.com"}, AllowedHeaders: []string{"Content-Type", "X-Api-Key"}, MaxAge: 600},
+			origin:  "https://app.example.com",
+			method:  http.MethodPost,
+			want: map[string]string{
+				"Allow":                        "GET, POST, OPTIONS",
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "Content-Type, X-Api-Key",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:    "any origin and requested headers",
+			options: CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"get", "post"}, AllowedHeaders: []string{"*"}, AllowCredentials: true},
+			origin:  "https://other.io",
+			method:  http.MethodGet,
+			headers: "X-Custom",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "X-Custom",
+				"Access-Control-Max-Age":           "",
+			},
+		},
+		{
+			name:    "method not allowed",
+			options: CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}},
+			origin:  "https://other.io",
+			method:  http.MethodDelete,
+			want: map[string]string{
+				"Allow":                        "GET, POST, OPTIONS",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:    "origin not allowed",
+			options: CORSOptions{AllowedOrigins: []string{"https://app.example.com"}},
+			origin:  "https://evil.io",
+			method:  http.MethodPost,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:    "not a preflight",
+			options: CORSOptions{AllowedOrigins: []string{"*"}},
+			origin:  "https://other.io",
+			want: map[string]string{
+				"Allow":                        "GET, POST, OPTIONS",
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := corsRouter(&tt.options)
+			r := httptest.NewRequest(http.MethodOptions, "/v1/accounts", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.method != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.method)
+			}
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			hr.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithoutOrigins(t *testing.T) {
+	if mr := New(&Options{Router: httprouter.New(), CORS: &CORSOptions{}}); mr.cors != nil {
+		t.Error("cors enabled without AllowedOrigins")
+	}
+}
@@ -2,12 +2,21 @@ package router
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/sampling"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/auth"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/limiter"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/ratelimit"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/shutdown"
 	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
 	"github.com/felixge/httpsnoop"
 	"github.com/julienschmidt/httprouter"
@@ -22,11 +31,30 @@ type MyRouter struct {
 	Httprouter     *httprouter.Router
 	WrappedHandler http.Handler
 	Options        *Options
+
+	// timeout in seconds, initialized from Options and changed by SetTimeout
+	timeout int64
+	cors    *cors
+	// preflights holds the Allow header per path, whose preflight this router answers,
+	// it is built while registering so the preflights only read it
+	preflights map[string]string
 }
 
 type Options struct {
 	Prefix  string
 	Timeout int
+	// Router is where the routes are registered, HttpRouter when nil
+	Router *httprouter.Router
+	// Auth authenticates the requests, none when nil
+	Auth *auth.Guard
+	// Limiter caps the concurrent handlers, unlimited when nil
+	Limiter *limiter.Limiter
+	// RateLimiter limits the requests per client before authentication and per caller after, unlimited when nil
+	RateLimiter *ratelimit.Limiter
+	// CORS allows the cross-origin requests and answers their preflight, disabled when nil
+	CORS *CORSOptions
+	// Shutdown waits for the handlers on shutdown, even those outliving their timeout, none when nil
+	Shutdown *shutdown.Controller
 }
 
 type WrittenResponseWriter struct {
@@ -50,8 +78,23 @@ func (w *WrittenResponseWriter) Written() bool {
 
 var HttpRouter *httprouter.Router
 
+// RouterMetric is the histogram of every request served by HttpRouter
+const RouterMetric = "http_router"
+
+// Observer is notified of every request outcome seen by WrapperHandler
+type Observer interface {
+	Observe(route string, code int, latency time.Duration)
+}
+
+// WrapperOptions holds the dependencies of WrapperHandler
+type WrapperOptions struct {
+	Metric    metric.MetricInterface
+	Sampler   sampling.Policy
+	Observers []Observer
+}
+
 // WrapperHandler used to wrap web handler
-func WrapperHandler(metric metric.MetricInterface) http.Handler {
+func WrapperHandler(o *WrapperOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		writtenResponseWriter := &WrittenResponseWriter{
 			ResponseWriter: w,
@@ -78,27 +121,90 @@ func WrapperHandler(metric metric.MetricInterface) http.Handler {
 			fmt.Sprintf("url_path:%s", urlPathTag),
 			fmt.Sprintf("url:%s", r.URL.Path),
 			fmt.Sprintf("resp_code:%d", m.Code),
+			fmt.Sprintf("proto:%s", r.Proto),
+			fmt.Sprintf("tls_version:%s", tlsVersion(r)),
+		}
+
+		for _, observer := range o.Observers {
+			observer.Observe(urlPathTag, m.Code, m.Duration)
+		}
+
+		// the client drops the sample according to the rate and lets datadog upscale the counts,
+		// errors are flagged so the sampler can keep all of them
+		rate := float64(1)
+		if o.Sampler != nil {
+			rate = o.Sampler.Rate(RouterMetric, urlPathTag, sampling.IsErrorStatus(o.Sampler, m.Code))
 		}
 
 		// metric submission to ddog agent, in here comm. will be UDP, so we no need to wait the response back
-		go metric.Histogram("http_router", start, tags)
+		go o.Metric.Histogram(RouterMetric, start, tags, rate)
 	})
 }
 
+// tlsVersion returns the tls version of the request connection, none over plain http
+func tlsVersion(r *http.Request) string {
+	if r.TLS == nil {
+		return "none"
+	}
+	switch r.TLS.Version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return "unknown"
+}
+
 func New(o *Options) *MyRouter {
 	myrouter := &MyRouter{
 		Options:    o,
 		Httprouter: HttpRouter,
+		timeout:    int64(o.Timeout),
+	}
+	if o.Router != nil {
+		myrouter.Httprouter = o.Router
+	}
+	if o.CORS != nil && len(o.CORS.AllowedOrigins) > 0 {
+		myrouter.cors = newCORS(o.CORS)
+		myrouter.preflights = map[string]string{}
 	}
 	return myrouter
 }
 
+// handlePreflight answers the preflight requests of fullPath once its first method is
+// registered, the routes other routers register on the same httprouter are left out
+func (mr *MyRouter) handlePreflight(method, fullPath string) {
+	if mr.cors == nil {
+		return
+	}
+	allow, registered := mr.preflights[fullPath]
+	if registered {
+		mr.preflights[fullPath] = strings.TrimSuffix(allow, ", "+http.MethodOptions) + ", " + method + ", " + http.MethodOptions
+		return
+	}
+	mr.preflights[fullPath] = method + ", " + http.MethodOptions
+	mr.Httprouter.OPTIONS(fullPath, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Allow", mr.preflights[fullPath])
+		mr.cors.preflight(w, r)
+	})
+}
+
+// SetTimeout changes the timeout in seconds of the handlers, it is safe to call while serving
+func (mr *MyRouter) SetTimeout(timeout int) {
+	atomic.StoreInt64(&mr.timeout, int64(timeout))
+}
+
 type Handle func(http.ResponseWriter, *http.Request, httprouter.Params) *response.JSONResponse
 
 func (mr *MyRouter) GET(path string, handle Handle) {
 	fullPath := mr.Options.Prefix + path
 	log.Println(fullPath)
 	mr.Httprouter.GET(fullPath, mr.handleNow(fullPath, handle))
+	mr.handlePreflight(http.MethodGet, fullPath)
 }
 
 func (mr *MyRouter) GETFile(path string, handle httprouter.Handle) {
@@ -111,24 +217,28 @@ func (mr *MyRouter) POST(path string, handle Handle) {
 	fullPath := mr.Options.Prefix + path
 	log.Println(fullPath)
 	mr.Httprouter.POST(fullPath, mr.handleNow(fullPath, handle))
+	mr.handlePreflight(http.MethodPost, fullPath)
 }
 
 func (mr *MyRouter) PUT(path string, handle Handle) {
 	fullPath := mr.Options.Prefix + path
 	log.Println(fullPath)
 	mr.Httprouter.PUT(fullPath, mr.handleNow(fullPath, handle))
+	mr.handlePreflight(http.MethodPut, fullPath)
 }
 
 func (mr *MyRouter) PATCH(path string, handle Handle) {
 	fullPath := mr.Options.Prefix + path
 	log.Println(fullPath)
 	mr.Httprouter.PATCH(fullPath, mr.handleNow(fullPath, handle))
+	mr.handlePreflight(http.MethodPatch, fullPath)
 }
 
 func (mr *MyRouter) DELETE(path string, handle Handle) {
 	fullPath := mr.Options.Prefix + path
 	log.Println(fullPath)
 	mr.Httprouter.DELETE(fullPath, mr.handleNow(fullPath, handle))
+	mr.handlePreflight(http.MethodDelete, fullPath)
 }
 
 func (mr *MyRouter) OPTIONS(path string, handle Handle) {
@@ -148,7 +258,7 @@ func (mr *MyRouter) TestHack(fullPath string, handle Handle) httprouter.Handle {
 func (mr *MyRouter) handleNow(fullPath string, handle Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		t := time.Now()
-		ctx, cancel := context.WithTimeout(r.Context(), time.Second*time.Duration(mr.Options.Timeout))
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*time.Duration(atomic.LoadInt64(&mr.timeout)))
 
 		defer cancel()
 
@@ -157,8 +267,57 @@ func (mr *MyRouter) handleNow(fullPath string, handle Handle) httprouter.Handle
 		r.Header.Set("routePath", fullPath)
 		r = r.WithContext(ctx)
 
-		respChan := make(chan *response.JSONResponse)
+		// set first so the browser can read the rejections below too
+		if mr.cors != nil {
+			mr.cors.setHeaders(w, r)
+		}
+
+		// the client ip is limited before authentication so the credentials cannot be guessed
+		// faster than the limit, the authenticated caller is limited after it
+		if res, ok := mr.Options.RateLimiter.AllowClient(r, fullPath); ok {
+			res.SetHeaders(w.Header())
+			if !res.Allowed {
+				resp := response.NewJSONResponse().SetError(response.ErrTooManyRequests)
+				resp.SetLatency(time.Since(t).Seconds() * 1000)
+				resp.Render(w, r)
+				return
+			}
+		}
+
+		r, err := mr.Options.Auth.Authenticate(r, fullPath)
+		if err != nil {
+			resp := response.NewJSONResponse().SetError(err)
+			resp.SetLatency(time.Since(t).Seconds() * 1000)
+			resp.Render(w, r)
+			return
+		}
+
+		if res, ok := mr.Options.RateLimiter.Allow(r, fullPath); ok {
+			res.SetHeaders(w.Header())
+			if !res.Allowed {
+				resp := response.NewJSONResponse().SetError(response.ErrTooManyRequests)
+				resp.SetLatency(time.Since(t).Seconds() * 1000)
+				resp.Render(w, r)
+				return
+			}
+		}
+
+		release, err := mr.Options.Limiter.Acquire(r.Context(), fullPath)
+		if err != nil {
+			retryAfter := mr.Options.Limiter.RetryAfter()
+			w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+			resp := response.NewJSONResponse().SetError(response.ErrServiceUnavailable).SetMessage(err.Error())
+			resp.SetLatency(time.Since(t).Seconds() * 1000)
+			resp.Render(w, r)
+			return
+		}
+
+		// buffered so the handler goroutine does not leak when the request timed out
+		respChan := make(chan *response.JSONResponse, 1)
+		done := mr.Options.Shutdown.Begin()
 		go func() {
+			defer done()
+			defer release()
 			defer panicRecover(r, fullPath)
 			resp := handle(w, r, ps)
 			respChan <- resp
@@ -181,7 +340,7 @@ func (mr *MyRouter) handleNow(fullPath string, handle Handle) httprouter.Handle
 					"Latency":          resp.Latency,
 					"Request-URI":      r.URL.RequestURI(),
 				}).Info("Request processed")
-				resp.Send(w)
+				resp.Render(w, r)
 			} else {
 				if w, ok := w.(*WrittenResponseWriter); ok && !w.Written() {
 					log.Println("Error nil response from the handler")
@@ -206,6 +365,6 @@ func GetHttpParam(ctx context.Context, name string) string {
 func panicRecover(r *http.Request, path string) {
 	if err := recover(); err != nil {
 		stackTrace := string(debug.Stack())
-		log.Println("got panic in api handler, [Path] %s, [err] %v, stacktrace", path, err, stackTrace)
+		log.Printf("got panic in api handler, [Path] %s, [err] %v, stacktrace %s", path, err, stackTrace)
 	}
 }
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"gopkg.in/tokopedia/grace.v1"
+)
+
+// ErrAlreadyStarted is returned when Start is called more than once
+var ErrAlreadyStarted = errors.New("server already started")
+
+// Options are the http server tunables, zero values mean no limit or the net/http default
+type Options struct {
+	Port              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// TLS serves https, negotiating HTTP/2 unless DisableHTTP2 is set
+	TLS          *TLSOptions
+	DisableHTTP2 bool
+	// H2C serves HTTP/2 over plain text connections, it is ignored with TLS
+	H2C bool
+	// OnServe is called once the listener is bound, right before serving
+	OnServe func()
+}
+
+// Server is an http server with an explicit lifecycle: Start binds the port and
+// serves in the background, Stop shuts it down gracefully and Wait blocks until
+// it is done
+type Server struct {
+	opt     Options
+	handler http.Handler
+
+	mu      sync.Mutex
+	server  *http.Server
+	certs   *certReloader
+	started bool
+
+	errCh chan error
+	done  chan struct{}
+	err   error
+}
+
+// New init new server, it does not listen until Start is called
+func New(handler http.Handler, o *Options) *Server {
+	if o == nil {
+		o = &Options{}
+	}
+	return &Server{
+		opt:     *o,
+		handler: handler,
+		errCh:   make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start binds the port and serves in the background. A bind failure is returned
+// directly, a failure while serving is reported by Wait and ListenError.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+
+	var tlsCfg *tls.Config
+	if s.opt.TLS != nil {
+		certs, err := newCertReloader(s.opt.TLS.CertFile, s.opt.TLS.KeyFile, s.opt.TLS.ReloadInterval)
+		if err != nil {
+			return err
+		}
+		tlsCfg, err = tlsConfig(s.opt.TLS, certs)
+		if err != nil {
+			return err
+		}
+		s.certs = certs
+	}
+
+	handler := s.handler
+	if s.opt.H2C && tlsCfg == nil && !s.opt.DisableHTTP2 {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: s.opt.IdleTimeout})
+	}
+
+	// grace.Listen reuses the socket passed by the parent process on graceful restart
+	l, err := grace.Listen(s.opt.Port)
+	if err != nil {
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsCfg,
+		ReadTimeout:       s.opt.ReadTimeout,
+		ReadHeaderTimeout: s.opt.ReadHeaderTimeout,
+		WriteTimeout:      s.opt.WriteTimeout,
+		IdleTimeout:       s.opt.IdleTimeout,
+		MaxHeaderBytes:    s.opt.MaxHeaderBytes,
+	}
+	if s.opt.DisableHTTP2 {
+		// a non nil empty map turns off the automatic HTTP/2 upgrade
+		s.server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	s.started = true
+
+	if s.certs != nil {
+		s.certs.Start()
+	}
+	go s.serve(l)
+	return nil
+}
+
+func (s *Server) serve(l net.Listener) {
+	if s.opt.OnServe != nil {
+		s.opt.OnServe()
+	}
+
+	var err error
+	if s.server.TLSConfig != nil {
+		// the certificate is served by TLSConfig.GetCertificate
+		err = s.server.ServeTLS(l, "", "")
+	} else {
+		err = s.server.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+
+	s.err = err
+	if err != nil {
+		s.errCh <- err
+	}
+	close(s.done)
+}
+
+// Stop stops accepting new connections and waits for the active ones until ctx is done
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	certs := s.certs
+	s.mu.Unlock()
+
+	if certs != nil {
+		certs.Stop()
+	}
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// Wait blocks until the server stops serving, it returns nil after a Stop or
+// when the server was never started
+func (s *Server) Wait() error {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+	<-s.done
+	return s.err
+}
+
+// Done is closed once the server stops serving
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// ListenError receives the error the server stopped serving with, if any
+func (s *Server) ListenError() <-chan error {
+	return s.errCh
+}
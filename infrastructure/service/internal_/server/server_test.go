@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// freePort returns a local address nothing listens on
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// protoHandler answers with the protocol of the request
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, r.Proto)
+})
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestServerLifecycle(t *testing.T) {
+	addr := freePort(t)
+	served := make(chan struct{})
+	s := New(protoHandler, &Options{Port: addr, OnServe: func() { close(served) }})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	<-served
+	if err := s.Start(); err != ErrAlreadyStarted {
+		t.Errorf("second Start() error = %v, want %v", err, ErrAlreadyStarted)
+	}
+	if got := get(t, http.DefaultClient, "http://"+addr); got != "HTTP/1.1" {
+		t.Errorf("response = %q, want HTTP/1.1", got)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait() error = %v, want nil after Stop", err)
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Error("Done() not closed once stopped")
+	}
+	select {
+	case err := <-s.ListenError():
+		t.Errorf("ListenError() = %v after Stop", err)
+	default:
+	}
+}
+
+func TestServerStartBindFailure(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := New(protoHandler, &Options{Port: l.Addr().String()})
+	if err := s.Start(); err == nil {
+		t.Fatal("Start() on a bound port error = nil")
+	}
+	// nothing to wait for, the caller must not block on a server that never started
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait() error = %v, want nil", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Errorf("Stop() error = %v, want nil", err)
+	}
+}
+
+func TestServerStopDeadline(t *testing.T) {
+	addr := freePort(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), &Options{Port: addr})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer close(release)
+	go http.Get("http://" + addr)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop() error = %v, want %v while a request is active", err, context.DeadlineExceeded)
+	}
+}
+
+func TestServerH2C(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    string
+	}{
+		{"h2c", Options{H2C: true}, "HTTP/2.0"},
+		{"http2 disabled", Options{H2C: true, DisableHTTP2: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.Port = freePort(t)
+			s := New(protoHandler, &tt.options)
+			if err := s.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer s.Stop(context.Background())
+
+			// prior knowledge HTTP/2 over plain text
+			client := &http.Client{Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+					return net.Dial(network, addr)
+				},
+			}}
+			url := "http://" + tt.options.Port
+			if tt.want == "" {
+				if _, err := client.Get(url); err == nil {
+					t.Error("HTTP/2 request error = nil, want HTTP/2 refused")
+				}
+				return
+			}
+			if got := get(t, client, url); got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
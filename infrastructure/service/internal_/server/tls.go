@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultCertReloadInterval is used when the configured interval is not positive
+const DefaultCertReloadInterval = time.Minute
+
+// TLSOptions are the tls settings, the server serves plain http when nil
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is 1.0, 1.1, 1.2 or 1.3, 1.2 when empty
+	MinVersion string
+	// CipherSuites are the names of crypto/tls, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	// They are ignored by tls 1.3, the go defaults are used when empty.
+	CipherSuites []string
+	// ClientAuth is none, request, require, verify_if_given or verify, the last two
+	// check the client certificate against ClientCAFile
+	ClientAuth   string
+	ClientCAFile string
+	// ReloadInterval is how often the certificate files are checked for changes
+	ReloadInterval time.Duration
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                tls.NoClientCert,
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"require":         tls.RequireAnyClientCert,
+	"verify_if_given": tls.VerifyClientCertIfGiven,
+	"verify":          tls.RequireAndVerifyClientCert,
+}
+
+// tlsConfig builds the server tls config, the certificate is served by reloader
+func tlsConfig(o *TLSOptions, reloader *certReloader) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if o.MinVersion != "" {
+		v, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version %s", o.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	for _, name := range o.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	clientAuth, ok := clientAuthTypes[strings.ToLower(o.ClientAuth)]
+	if !ok {
+		return nil, fmt.Errorf("unknown client auth %s", o.ClientAuth)
+	}
+	cfg.ClientAuth = clientAuth
+
+	if o.ClientCAFile != "" {
+		/* #nosec G304 */
+		pem, err := ioutil.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+	return cfg, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// certReloader serves the certificate of CertFile and KeyFile, loading it again
+// when one of them changes. A failed load keeps the current certificate.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	if interval <= 0 {
+		interval = DefaultCertReloadInterval
+	}
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTimes = r.currentModTimes()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) currentModTimes() [2]time.Time {
+	var mt [2]time.Time
+	for i, fname := range []string{r.certFile, r.keyFile} {
+		if fi, err := os.Stat(fname); err == nil {
+			mt[i] = fi.ModTime()
+		}
+	}
+	return mt
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.currentModTimes() != r.modTimes
+}
+
+// Start watches the certificate files
+func (r *certReloader) Start() {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.load(); err != nil {
+					log.Println("failed to reload tls certificate, keeping the current one:", err)
+					continue
+				}
+				log.Println("tls certificate reloaded from", r.certFile)
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops watching
+func (r *certReloader) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
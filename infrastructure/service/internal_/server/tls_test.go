@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate of name for 127.0.0.1 to dir/cert.pem and
+// dir/key.pem, their mod time is set to modTime so a rewrite is always seen as a change
+func writeCert(t *testing.T, dir, name string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for fname, block := range files {
+		path := filepath.Join(dir, fname)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// servedName returns the common name of the certificate served by r
+func servedName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeCert(t, dir, "ca", time.Now())
+	ca := filepath.Join(dir, "cert.pem")
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		options        TLSOptions
+		wantMinVersion uint16
+		wantCiphers    []uint16
+		wantClientAuth tls.ClientAuthType
+		wantErr        string
+	}{
+		{"defaults", TLSOptions{}, tls.VersionTLS12, nil, tls.NoClientCert, ""},
+		{"min version", TLSOptions{MinVersion: "1.3"}, tls.VersionTLS13, nil, tls.NoClientCert, ""},
+		{"cipher suites", TLSOptions{CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tls.NoClientCert, ""},
+		{"client auth", TLSOptions{ClientAuth: "Verify", ClientCAFile: ca}, tls.VersionTLS12, nil, tls.RequireAndVerifyClientCert, ""},
+		{"unknown version", TLSOptions{MinVersion: "1.4"}, 0, nil, 0, "unknown tls version 1.4"},
+		{"unknown cipher suite", TLSOptions{CipherSuites: []string{"TLS_NONE"}}, 0, nil, 0, "unknown cipher suite TLS_NONE"},
+		{"unknown client auth", TLSOptions{ClientAuth: "always"}, 0, nil, 0, "unknown client auth always"},
+		{"missing client ca", TLSOptions{ClientCAFile: filepath.Join(dir, "missing.pem")}, 0, nil, 0, "no such file"},
+		{"invalid client ca", TLSOptions{ClientCAFile: notPEM}, 0, nil, 0, "no certificate found in " + notPEM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tlsConfig(&tt.options, &certReloader{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("tlsConfig() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tlsConfig() error = %v", err)
+			}
+			if cfg.MinVersion != tt.wantMinVersion || cfg.ClientAuth != tt.wantClientAuth || len(cfg.CipherSuites) != len(tt.wantCiphers) {
+				t.Errorf("tlsConfig() = min version %x, client auth %v, ciphers %v, want %x, %v, %v",
+					cfg.MinVersion, cfg.ClientAuth, cfg.CipherSuites, tt.wantMinVersion, tt.wantClientAuth, tt.wantCiphers)
+			}
+			if (tt.options.ClientCAFile != "") != (cfg.ClientCAs != nil) {
+				t.Errorf("ClientCAs = %v with ClientCAFile %q", cfg.ClientCAs, tt.options.ClientCAFile)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+	writeCert(t, dir, "first", modTime)
+
+	r, err := newCertReloader(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	if r.interval != DefaultCertReloadInterval || servedName(t, r) != "first" || r.changed() {
+		t.Fatalf("newCertReloader() = interval %s serving %s, want the default interval serving first", r.interval, servedName(t, r))
+	}
+
+	modTime = modTime.Add(time.Minute)
+	writeCert(t, dir, "second", modTime)
+	if !r.changed() {
+		t.Fatal("changed() = false once the files are rewritten")
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if got := servedName(t, r); got != "second" {
+		t.Errorf("serving %s, want second", got)
+	}
+
+	// a broken pair keeps the current certificate
+	if err := ioutil.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.load(); err == nil {
+		t.Error("load() of a broken key error = nil")
+	}
+	if got := servedName(t, r); got != "second" {
+		t.Errorf("serving %s after a failed load, want second", got)
+	}
+
+	if _, err := newCertReloader(certFile, keyFile, 0); err == nil {
+		t.Error("newCertReloader() of a broken key error = nil")
+	}
+}
+
+func TestCertReloaderStart(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	modTime := time.Now().Add(-time.Hour)
+	writeCert(t, dir, "first", modTime)
+
+	r, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	r.Start()
+	defer r.Stop()
+
+	writeCert(t, dir, "second", modTime.Add(time.Minute))
+	deadline := time.Now().Add(time.Second)
+	for servedName(t, r) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("the rewritten certificate was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	cert := writeCert(t, dir, "server", time.Now())
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	tests := []struct {
+		name         string
+		disableHTTP2 bool
+		want         string
+	}{
+		{"http2", false, "HTTP/2.0"},
+		{"http2 disabled", true, "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := freePort(t)
+			s := New(protoHandler, &Options{
+				Port:         addr,
+				TLS:          &TLSOptions{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")},
+				DisableHTTP2: tt.disableHTTP2,
+			})
+			if err := s.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer s.Stop(context.Background())
+
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots},
+				ForceAttemptHTTP2: true,
+			}}
+			if got := get(t, client, "https://"+addr); got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerTLSStartFailure(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeCert(t, dir, "server", time.Now())
+	tests := []struct {
+		name string
+		tls  TLSOptions
+	}{
+		{"missing certificate", TLSOptions{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "key.pem")}},
+		{"invalid settings", TLSOptions{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"), MinVersion: "1.4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(protoHandler, &Options{Port: freePort(t), TLS: &tt.tls})
+			if err := s.Start(); err == nil {
+				s.Stop(context.Background())
+				t.Fatal("Start() error = nil")
+			}
+			if err := s.Wait(); err != nil {
+				t.Errorf("Wait() error = %v, want nil", err)
+			}
+		})
+	}
+}
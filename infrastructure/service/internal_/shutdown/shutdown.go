@@ -0,0 +1,163 @@
+package shutdown
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTimeout is used when the configured shutdown timeout is not positive
+const DefaultTimeout = 20 * time.Second
+
+// Hook is run on shutdown, after the in-flight requests are drained
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// Options holds the shutdown settings
+type Options struct {
+	// DrainDelay is how long the service keeps accepting requests once reported not ready,
+	// so the load balancers stop routing to it before the listener closes
+	DrainDelay time.Duration
+}
+
+// Controller coordinates the shutdown: readiness, in-flight draining and the hooks
+// flushing whatever is buffered
+type Controller struct {
+	ready    int32
+	inFlight int64
+
+	drainDelay time.Duration
+
+	mu    sync.Mutex
+	hooks []namedHook
+}
+
+// New init new shutdown controller, not ready until SetReady is called
+func New(o *Options) *Controller {
+	c := &Controller{}
+	if o != nil && o.DrainDelay > 0 {
+		c.drainDelay = o.DrainDelay
+	}
+	return c
+}
+
+// SetReady marks the service ready, or not, to receive traffic
+func (c *Controller) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&c.ready, v)
+}
+
+// Ready returns whether the service is ready to receive traffic
+func (c *Controller) Ready() bool {
+	return atomic.LoadInt32(&c.ready) == 1
+}
+
+// InFlight returns the number of requests and handlers being run
+func (c *Controller) InFlight() int64 {
+	return atomic.LoadInt64(&c.inFlight)
+}
+
+// Begin counts a unit of work in flight until done is called, e.g. a handler goroutine
+// outliving the timeout of its request. It is a no-op on a nil controller.
+func (c *Controller) Begin() (done func()) {
+	if c == nil {
+		return func() {}
+	}
+	atomic.AddInt64(&c.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&c.inFlight, -1)
+	}
+}
+
+// Track wraps next to count its in-flight requests
+func (c *Controller) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer c.Begin()()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OnShutdown registers a hook, hooks are run in registration order
+func (c *Controller) OnShutdown(name string, fn Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, namedHook{name: name, fn: fn})
+}
+
+// drainInterval is how often the in-flight counter is checked while draining
+const drainInterval = 50 * time.Millisecond
+
+// drain waits until there is no in-flight request or handler or ctx is done
+func (c *Controller) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for c.InFlight() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown marks the service not ready, waits for the drain delay, stops accepting
+// with stop, waits for the in-flight requests until ctx is done, then runs the hooks.
+// The drain delay is skipped when the service was not ready, e.g. it failed to start.
+// Hooks are run even when the deadline is exceeded, the first error met is returned.
+func (c *Controller) Shutdown(ctx context.Context, stop func(ctx context.Context) error) error {
+	wasReady := c.Ready()
+	c.SetReady(false)
+
+	var firstErr error
+	if wasReady && c.drainDelay > 0 {
+		log.Printf("not ready, waiting %s before closing the listener", c.drainDelay)
+		timer := time.NewTimer(c.drainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	if stop != nil {
+		if err := stop(ctx); err != nil {
+			log.Println("failed to stop accepting requests:", err)
+			firstErr = err
+		}
+	}
+
+	if err := c.drain(ctx); err != nil {
+		log.Printf("shutdown deadline exceeded with %d in-flight requests", c.InFlight())
+		if firstErr == nil {
+			firstErr = err
+		}
+	} else {
+		log.Println("in-flight requests drained")
+	}
+
+	c.mu.Lock()
+	hooks := append([]namedHook{}, c.hooks...)
+	c.mu.Unlock()
+
+	for _, h := range hooks {
+		if err := h.fn(ctx); err != nil {
+			log.Printf("shutdown hook %s failed: %s", h.name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
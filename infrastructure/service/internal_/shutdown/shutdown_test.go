@@ -0,0 +1,127 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsHandlers(t *testing.T) {
+	c := New(nil)
+	c.SetReady(true)
+
+	// a handler goroutine outliving its request
+	done := c.Begin()
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(3 * drainInterval)
+		close(released)
+		done()
+	}()
+
+	stopped := false
+	err := c.Shutdown(context.Background(), func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("Shutdown() returned before the handler was done")
+	}
+	if !stopped || c.Ready() {
+		t.Errorf("stopped = %v, ready = %v, want stopped and not ready", stopped, c.Ready())
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	c := New(nil)
+	c.Begin()
+	hookRun := false
+	c.OnShutdown("flush", func(ctx context.Context) error {
+		hookRun = true
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainInterval)
+	defer cancel()
+	if err := c.Shutdown(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !hookRun {
+		t.Error("the hooks were not run once the deadline was exceeded")
+	}
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		ready     bool
+		wantDelay bool
+	}{
+		{"ready", true, true},
+		// e.g. the server failed to start
+		{"never ready", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay := 100 * time.Millisecond
+			c := New(&Options{DrainDelay: delay})
+			c.SetReady(tt.ready)
+
+			start := time.Now()
+			var readyAtStop bool
+			c.Shutdown(context.Background(), func(ctx context.Context) error {
+				readyAtStop = c.Ready()
+				return nil
+			})
+			if readyAtStop {
+				t.Error("still ready when the listener is closed")
+			}
+			if waited := time.Since(start) >= delay; waited != tt.wantDelay {
+				t.Errorf("waited the drain delay = %v, want %v", waited, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestShutdownHookErrors(t *testing.T) {
+	c := New(nil)
+	first, second := errors.New("first"), errors.New("second")
+	order := []string{}
+	c.OnShutdown("a", func(ctx context.Context) error {
+		order = append(order, "a")
+		return first
+	})
+	c.OnShutdown("b", func(ctx context.Context) error {
+		order = append(order, "b")
+		return second
+	})
+	if err := c.Shutdown(context.Background(), nil); err != first {
+		t.Errorf("Shutdown() error = %v, want %v", err, first)
+	}
+	if len(order) != 2 || order[0] != "a" {
+		t.Errorf("hooks run = %v, want a then b", order)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	c := New(nil)
+	var during int64
+	h := c.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = c.InFlight()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if during != 1 || c.InFlight() != 0 {
+		t.Errorf("in flight = %d during and %d after the request, want 1 and 0", during, c.InFlight())
+	}
+
+	var nilController *Controller
+	nilController.Begin()()
+}
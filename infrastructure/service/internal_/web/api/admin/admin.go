@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/fault"
+	myrouter "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/router"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/shutdown"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/slo"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+	"github.com/julienschmidt/httprouter"
+)
+
+// API serves the operational endpoints
+type API struct {
+	Cfg      *config.MainConfig
+	SLO      *slo.Tracker
+	Shutdown *shutdown.Controller
+	Fault    *fault.Controller
+
+	cfg atomic.Value
+}
+
+// BuildInfo describes the running binary and the modules it was built with
+type BuildInfo struct {
+	buildinfo.Info
+	Path string            `json:"path,omitempty"`
+	Deps map[string]string `json:"deps,omitempty"`
+}
+
+// New is the admin api initializer
+func New(this *API) *API {
+	a := &API{
+		Cfg:      this.Cfg,
+		SLO:      this.SLO,
+		Shutdown: this.Shutdown,
+		Fault:    this.Fault,
+	}
+	a.cfg.Store(this.Cfg)
+	return a
+}
+
+// Register registers the health, readiness, slo and build endpoints
+func (a *API) Register(router *myrouter.MyRouter) {
+	a.RegisterHealth(router)
+	router.GET("/admin/build", a.Build)
+	if a.SLO != nil {
+		router.GET("/admin/slo", a.SLOStatus)
+	}
+}
+
+// RegisterHealth registers the health and readiness endpoints only, the ones safe to serve publicly
+func (a *API) RegisterHealth(router *myrouter.MyRouter) {
+	router.GET("/health", a.Health)
+	if a.Shutdown != nil {
+		router.GET("/ready", a.Readiness)
+	}
+}
+
+// RegisterDebug registers the endpoints exposing the internals or changing the
+// behaviour of the service: config dump, fault controls, expvar and pprof
+func (a *API) RegisterDebug(router *myrouter.MyRouter) {
+	router.GETFile("/admin/config", a.ConfigDump)
+	if a.Fault != nil {
+		router.GET("/admin/fault", a.GetFault)
+		router.PUT("/admin/fault", a.SetFault)
+		router.DELETE("/admin/fault", a.ResetFault)
+	}
+
+	router.GETFile("/debug/vars", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		expvar.Handler().ServeHTTP(w, r)
+	})
+	router.GETFile("/debug/pprof/", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		pprof.Index(w, r)
+	})
+	router.GETFile("/debug/pprof/:name", pprofHandler)
+}
+
+// ApplyConfig keeps the reloaded config for the config dump
+func (a *API) ApplyConfig(cfg *config.MainConfig) {
+	a.cfg.Store(cfg)
+}
+
+// Health returns OK as long as the process serves requests
+func (a *API) Health(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	return response.NewJSONResponse().SetData("OK")
+}
+
+// Readiness returns 503 once the service is shutting down so load balancers stop routing to it
+func (a *API) Readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	if !a.Shutdown.Ready() {
+		return response.NewJSONResponse().SetError(response.ErrServiceUnavailable)
+	}
+	return response.NewJSONResponse().SetData("Ready")
+}
+
+// SLOStatus returns the current error budget state of every objective
+func (a *API) SLOStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	return response.NewJSONResponse().SetData(a.SLO.Status())
+}
+
+// Build returns the build info and the module versions the binary was built with
+func (a *API) Build(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	info := BuildInfo{Info: buildinfo.Get()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path = bi.Main.Path
+		info.Deps = map[string]string{}
+		for _, dep := range bi.Deps {
+			info.Deps[dep.Path] = dep.Version
+		}
+	}
+	return response.NewJSONResponse().SetData(info)
+}
+
+// ConfigDump writes the effective config with the source of every value, secrets masked
+func (a *API) ConfigDump(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, config.Dump(a.cfg.Load().(*config.MainConfig)))
+}
+
+// GetFault returns the fault injected in the public endpoints
+func (a *API) GetFault(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	return response.NewJSONResponse().SetData(a.Fault.Get())
+}
+
+// SetFault replaces the fault injected in the public endpoints from the json body
+func (a *API) SetFault(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	f := fault.Fault{}
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		return response.NewJSONResponse().SetError(response.ErrBadRequest).SetMessage(err.Error())
+	}
+	if f.Rate < 0 || f.Rate > 1 || f.Latency < 0 {
+		return response.NewJSONResponse().SetError(response.ErrBadRequest).SetMessage("rate must be within 0 and 1 and latency not negative")
+	}
+	a.Fault.Set(f)
+	return response.NewJSONResponse().SetData(f)
+}
+
+// ResetFault stops injecting faults in the public endpoints
+func (a *API) ResetFault(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	a.Fault.Reset()
+	return response.NewJSONResponse().SetData(a.Fault.Get())
+}
+
+// pprofHandler serves the named profiles, plus the endpoints pprof.Index does not
+func pprofHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	switch ps.ByName("name") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(ps.ByName("name")).ServeHTTP(w, r)
+	}
+}
@@ -9,7 +9,15 @@ import (
 
 	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
 	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/sampling"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/auth"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/fault"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/limiter"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/ratelimit"
 	myrouter "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/router"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/shutdown"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/binding"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo"
 	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
 	"github.com/julienschmidt/httprouter"
 )
@@ -21,14 +29,58 @@ const (
 	HTTPCodeInternalServerError = 500
 )
 
+// HandlerResultMetric counts the outcome of the handlers, tagged with url_path and result:success or error
+const HandlerResultMetric = "handler.result"
+
+// Metric holds the metric client and the sampling policy to consult before submitting
 type Metric struct {
 	DDogSvcMetric metric.MetricInterface
+	Sampler       sampling.Policy
+}
+
+// Count submits a handler counter at the rate the sampler gives for name on route
+func (m *Metric) Count(name, route string, value int64, tags []string, isError bool) error {
+	return m.DDogSvcMetric.Count(name, value, tags, m.rate(name, route, isError))
+}
+
+// Histogram submits a handler latency since start at the rate the sampler gives for name on route
+func (m *Metric) Histogram(name, route string, start time.Time, tags []string, isError bool) error {
+	return m.DDogSvcMetric.Histogram(name, start, tags, m.rate(name, route, isError))
+}
+
+func (m *Metric) rate(name, route string, isError bool) float64 {
+	if m.Sampler == nil {
+		return 1
+	}
+	return m.Sampler.Rate(name, route, isError)
+}
+
+// countResult counts the outcome of the handler of r, err being the error it answers
+func (a *API) countResult(r *http.Request, err error) {
+	route := r.Header.Get("routePath")
+	result := "success"
+	isError := err != nil && sampling.IsErrorStatus(a.Metric.Sampler, response.GetHTTPCode(response.GetErrorCodeStr(err)))
+	if err != nil {
+		result = "error"
+	}
+	if e := a.Metric.Count(HandlerResultMetric, route, 1, []string{"url_path:" + route, "result:" + result}, isError); e != nil {
+		log.Println(e)
+	}
 }
 
 // API is the api struct
 type API struct {
-	Cfg    *config.MainConfig
-	Metric *Metric
+	Cfg         *config.MainConfig
+	Metric      *Metric
+	Fault       *fault.Controller
+	Auth        *auth.Guard
+	Limiter     *limiter.Limiter
+	RateLimiter *ratelimit.Limiter
+	Shutdown    *shutdown.Controller
+
+	router *myrouter.MyRouter
+	// binder binds the request bodies of the handlers, limited to API.MaxBodySize
+	binder *binding.Binder
 }
 
 type controlledBehaviour struct {
@@ -38,22 +90,59 @@ type controlledBehaviour struct {
 
 // New is the api initializer
 func New(this *API) *API {
-	return &API{
-		Cfg:    this.Cfg,
-		Metric: this.Metric,
+	a := &API{
+		Cfg:         this.Cfg,
+		Metric:      this.Metric,
+		Fault:       this.Fault,
+		Auth:        this.Auth,
+		Limiter:     this.Limiter,
+		RateLimiter: this.RateLimiter,
+		Shutdown:    this.Shutdown,
 	}
+	return a
 }
 
 // Register will register the api structure
 func (a *API) Register() {
-	router := myrouter.New(&myrouter.Options{Timeout: a.Cfg.API.DefaultTimeout, Prefix: a.Cfg.API.NormalPrefix})
+	cors := a.Cfg.CORS
+	router := myrouter.New(&myrouter.Options{
+		Timeout:     a.Cfg.API.DefaultTimeout,
+		Prefix:      a.Cfg.API.NormalPrefix,
+		Auth:        a.Auth,
+		Limiter:     a.Limiter,
+		RateLimiter: a.RateLimiter,
+		Shutdown:    a.Shutdown,
+		CORS: &myrouter.CORSOptions{
+			AllowedOrigins:   cors.AllowedOrigins,
+			AllowedMethods:   cors.AllowedMethods,
+			AllowedHeaders:   cors.AllowedHeaders,
+			ExposedHeaders:   cors.ExposedHeaders,
+			AllowCredentials: cors.AllowCredentials,
+			MaxAge:           cors.MaxAge,
+		},
+	})
+	a.router = router
+	a.binder = binding.New(&binding.Options{MaxBodySize: a.Cfg.API.MaxBodySize})
 	router.GET("/accounts", a.Accounts)
 	router.GET("/customers", a.Customers)
+	router.GET("/version", a.Version)
+}
+
+// Version returns the build info of the running binary
+func (a *API) Version(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
+	return response.NewJSONResponse().SetData(buildinfo.Get())
+}
+
+// ApplyConfig applies the values of a reloaded config used while serving
+func (a *API) ApplyConfig(cfg *config.MainConfig) {
+	if a.router != nil {
+		a.router.SetTimeout(cfg.API.DefaultTimeout)
+	}
 }
 
 // Accounts handle accounts endpoint
 func (a *API) Accounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
-	behaviour, err := parseControlledBehaviour(r)
+	behaviour, err := parseControlledBehaviour(r, a.Fault)
 	if err != nil {
 		return response.NewJSONResponse().SetError(response.ErrInternalServerError).SetMessage(fmt.Sprintf("%s error - %s", "Accounts", err.Error()))
 	}
@@ -64,6 +153,7 @@ func (a *API) Accounts(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 		log.Println("Latency: ", behaviour.LatencyInSecond)
 	}
+	a.countResult(r, behaviour.Err)
 	if behaviour.Err != nil {
 		return response.NewJSONResponse().SetError(behaviour.Err).SetMessage(fmt.Sprintf("%s error - %s", "Accounts", behaviour.Err.Error()))
 	}
@@ -78,7 +168,7 @@ func (a *API) Accounts(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 // Customers handle customers endpoint
 func (a *API) Customers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.JSONResponse {
-	behaviour, err := parseControlledBehaviour(r)
+	behaviour, err := parseControlledBehaviour(r, a.Fault)
 	if err != nil {
 		return response.NewJSONResponse().SetError(response.ErrInternalServerError).SetMessage(fmt.Sprintf("%s error - %s", "Customers", response.ErrInternalServerError.Error()))
 	}
@@ -89,6 +179,7 @@ func (a *API) Customers(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 
 		log.Println("Latency: ", behaviour.LatencyInSecond)
 	}
+	a.countResult(r, behaviour.Err)
 	if behaviour.Err != nil {
 		return response.NewJSONResponse().SetError(behaviour.Err).SetMessage(fmt.Sprintf("%s error - %s", "Customers", behaviour.Err.Error()))
 	}
@@ -96,9 +187,18 @@ func (a *API) Customers(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	return response.NewJSONResponse().SetData("Succeeded")
 }
 
-func parseControlledBehaviour(r *http.Request) (b controlledBehaviour, err error) {
+// parseControlledBehaviour returns the behaviour asked by the request query, on top of the runtime fault
+func parseControlledBehaviour(r *http.Request, f *fault.Controller) (b controlledBehaviour, err error) {
 	b = controlledBehaviour{}
 
+	if f != nil {
+		statusCode, latency := f.Inject()
+		if statusCode != 0 {
+			b.Err = statusCodeError(statusCode)
+		}
+		b.LatencyInSecond = latency
+	}
+
 	rawStatusCode := r.URL.Query().Get("status_code")
 	if len(rawStatusCode) > 0 {
 		statusCode, e := strconv.Atoi(rawStatusCode)
@@ -106,21 +206,7 @@ func parseControlledBehaviour(r *http.Request) (b controlledBehaviour, err error
 			err = e
 			return
 		}
-
-		switch statusCode {
-		case HTTPCodeBadRequest:
-			b.Err = response.ErrBadRequest
-			break
-		case HTTPForbiddenResource:
-			b.Err = response.ErrForbiddenResource
-			break
-		case HTTPGenericSuccess:
-			b.Err = nil
-			break
-		default:
-			b.Err = response.ErrInternalServerError
-			break
-		}
+		b.Err = statusCodeError(statusCode)
 	}
 
 	rawLatencyInSecond := r.URL.Query().Get("latency")
@@ -135,3 +221,16 @@ func parseControlledBehaviour(r *http.Request) (b controlledBehaviour, err error
 
 	return
 }
+
+func statusCodeError(statusCode int) error {
+	switch statusCode {
+	case HTTPCodeBadRequest:
+		return response.ErrBadRequest
+	case HTTPForbiddenResource:
+		return response.ErrForbiddenResource
+	case HTTPGenericSuccess:
+		return nil
+	default:
+		return response.ErrInternalServerError
+	}
+}
@@ -1,35 +1,201 @@
 package handler
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/auth"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/compress"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/fault"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/limiter"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/ratelimit"
 	myrouter "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/router"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/server"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/shutdown"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/web/api/admin"
 	api "github.com/ariefaprilianto/ddog-experimental/infrastructure/service/internal_/web/api/ddogsvc"
-	"gopkg.in/tokopedia/grace.v1"
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/slo"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/env"
+	"github.com/julienschmidt/httprouter"
 )
 
 //Handler is Web requests handler struct
 type Handler struct {
 	Cfg         *config.MainConfig
 	Metric      *api.Metric
-	listenErrCh chan error
+	SLO         *slo.Tracker
+	Shutdown    *shutdown.Controller
+	Fault       *fault.Controller
+	Auth        *auth.Guard
+	Limiter     *limiter.Limiter
+	RateLimiter *ratelimit.Limiter
+	api         *api.API
+	adminAPI    *admin.API
+	server      *server.Server
+	admin       *server.Server
+
+	errCh chan error
 }
 
 // New is the web handler initializer
 func New(this *Handler) *Handler {
-	a := &api.API{Cfg: this.Cfg, Metric: this.Metric}
-	api.New(a).Register()
+	if this.Shutdown == nil {
+		this.Shutdown = shutdown.New(nil)
+	}
+	if this.Fault == nil {
+		this.Fault = fault.New()
+	}
+	this.errCh = make(chan error, 2)
+
+	a := &api.API{Cfg: this.Cfg, Metric: this.Metric, Fault: this.Fault, Auth: this.Auth, Limiter: this.Limiter, RateLimiter: this.RateLimiter, Shutdown: this.Shutdown}
+	this.api = api.New(a)
+	this.api.Register()
+
+	this.adminAPI = admin.New(&admin.API{Cfg: this.Cfg, SLO: this.SLO, Shutdown: this.Shutdown, Fault: this.Fault})
+	if this.Cfg.Admin.Port == "" {
+		// without admin listener only health and readiness are served, by the public router
+		this.adminAPI.RegisterHealth(myrouter.New(&myrouter.Options{Timeout: this.Cfg.API.DefaultTimeout}))
+	} else {
+		this.admin = newAdminServer(this.Cfg, this.adminAPI)
+	}
+
+	observers := []myrouter.Observer{}
+	if this.SLO != nil {
+		observers = append(observers, this.SLO)
+	}
+	handler := this.Shutdown.Track(compress.Middleware(myrouter.WrapperHandler(&myrouter.WrapperOptions{
+		Metric:    this.Metric.DDogSvcMetric,
+		Sampler:   this.Metric.Sampler,
+		Observers: observers,
+	}), &compress.Options{
+		Encodings: compressEncodings(this.Cfg.Compression),
+		MinSize:   this.Cfg.Compression.MinSize,
+		Level:     this.Cfg.Compression.Level,
+		Metric:    this.Metric.DDogSvcMetric,
+		Sampler:   this.Metric.Sampler,
+	}))
+
+	var tlsOptions *server.TLSOptions
+	if tlsCfg := this.Cfg.TLS; tlsCfg.CertFile != "" {
+		tlsOptions = &server.TLSOptions{
+			CertFile:       tlsCfg.CertFile,
+			KeyFile:        tlsCfg.KeyFile,
+			MinVersion:     tlsCfg.MinVersion,
+			CipherSuites:   tlsCfg.CipherSuites,
+			ClientAuth:     tlsCfg.ClientAuth,
+			ClientCAFile:   tlsCfg.ClientCAFile,
+			ReloadInterval: time.Duration(tlsCfg.ReloadInterval) * time.Second,
+		}
+	}
+
+	srv := this.Cfg.Server
+	this.server = server.New(handler, &server.Options{
+		Port:              srv.Port,
+		ReadTimeout:       time.Duration(srv.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(srv.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(srv.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(srv.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    srv.MaxHeaderBytes,
+		TLS:               tlsOptions,
+		DisableHTTP2:      this.Cfg.TLS.DisableHTTP2,
+		H2C:               this.Cfg.TLS.H2C,
+		OnServe: func() {
+			log.Printf("Listening on %s", srv.Port)
+			this.Shutdown.SetReady(true)
+		},
+	})
 	return this
 }
 
-//Run is to run the web apis
-func (h *Handler) Run() {
-	log.Printf("Listening on %s", h.Cfg.Server.Port)
-	h.listenErrCh <- grace.Serve(h.Cfg.Server.Port, myrouter.WrapperHandler(h.Metric.DDogSvcMetric))
+// newAdminServer serves the operational endpoints on their own router, out of the http_router metric
+func newAdminServer(cfg *config.MainConfig, a *admin.API) *server.Server {
+	router := httprouter.New()
+	adminRouter := myrouter.New(&myrouter.Options{Timeout: cfg.API.DefaultTimeout, Router: router})
+	a.Register(adminRouter)
+	if cfg.Admin.Debug || env.Current().DebugEndpoints {
+		a.RegisterDebug(adminRouter)
+	}
+
+	return server.New(router, &server.Options{
+		Port:              cfg.Admin.Port,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout) * time.Second,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		OnServe: func() {
+			log.Printf("Admin listening on %s", cfg.Admin.Port)
+		},
+	})
+}
+
+// compressEncodings returns the configured encodings, br then gzip by default, none when disabled
+func compressEncodings(cfg config.CompressionConfig) []compress.Encoding {
+	if cfg.Disabled {
+		return nil
+	}
+	if len(cfg.Encodings) == 0 {
+		return []compress.Encoding{compress.Brotli, compress.Gzip}
+	}
+	encodings := []compress.Encoding{}
+	for _, name := range cfg.Encodings {
+		if enc, ok := compress.EncodingByName(name); ok {
+			encodings = append(encodings, enc)
+		}
+	}
+	return encodings
+}
+
+// ApplyConfig applies the values of a reloaded config to the apis
+func (h *Handler) ApplyConfig(cfg *config.MainConfig) {
+	h.api.ApplyConfig(cfg)
+	h.adminAPI.ApplyConfig(cfg)
+}
+
+// Start binds the server ports and serves the web apis in the background
+func (h *Handler) Start() error {
+	if h.admin != nil {
+		if err := h.admin.Start(); err != nil {
+			return err
+		}
+		go h.forwardError(h.admin)
+	}
+	if err := h.server.Start(); err != nil {
+		return err
+	}
+	go h.forwardError(h.server)
+	return nil
+}
+
+func (h *Handler) forwardError(s *server.Server) {
+	if err := <-s.ListenError(); err != nil {
+		h.errCh <- err
+	}
+}
+
+// Stop stops accepting new connections and waits for the active ones until ctx is done,
+// the admin listener is stopped last so the readiness stays observable while draining
+func (h *Handler) Stop(ctx context.Context) error {
+	err := h.server.Stop(ctx)
+	if h.admin != nil {
+		if adminErr := h.admin.Stop(ctx); err == nil {
+			err = adminErr
+		}
+	}
+	return err
+}
+
+// Wait blocks until the servers stop serving
+func (h *Handler) Wait() error {
+	err := h.server.Wait()
+	if h.admin != nil {
+		if adminErr := h.admin.Wait(); err == nil {
+			err = adminErr
+		}
+	}
+	return err
 }
 
 //ListenError will lister the error
 func (h *Handler) ListenError() <-chan error {
-	return h.listenErrCh
+	return h.errCh
 }
@@ -0,0 +1,77 @@
+package slo
+
+import (
+	"sync"
+	"time"
+)
+
+// maxBuckets bounds the memory used per objective, a 30 days window gets ~4 minutes buckets
+const maxBuckets = 10080
+
+type counts struct {
+	total       int64
+	unavailable int64
+	slow        int64
+}
+
+type bucket struct {
+	slot int64
+	counts
+}
+
+// ring keeps event counts in fixed width time buckets covering the window
+type ring struct {
+	mu      sync.Mutex
+	width   time.Duration
+	buckets []bucket
+}
+
+func newRing(window time.Duration) *ring {
+	width := window / maxBuckets
+	if width < time.Second {
+		width = time.Second
+	}
+	n := int(window/width) + 1
+	return &ring{
+		width:   width,
+		buckets: make([]bucket, n),
+	}
+}
+
+func (r *ring) add(now time.Time, unavailable, slow bool) {
+	slot := now.UnixNano() / int64(r.width)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := &r.buckets[slot%int64(len(r.buckets))]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+	b.total++
+	if unavailable {
+		b.unavailable++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+// sum adds up the buckets that fall in the last d
+func (r *ring) sum(now time.Time, d time.Duration) counts {
+	current := now.UnixNano() / int64(r.width)
+	oldest := current - int64(d/r.width)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := counts{}
+	for _, b := range r.buckets {
+		if b.slot > oldest && b.slot <= current {
+			c.total += b.total
+			c.unavailable += b.unavailable
+			c.slow += b.slow
+		}
+	}
+	return c
+}
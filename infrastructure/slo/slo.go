@@ -0,0 +1,153 @@
+package slo
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/config"
+	metric "github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions"
+	log "github.com/sirupsen/logrus"
+)
+
+// SLI kinds
+const (
+	SLIAvailability = "availability"
+	SLILatency      = "latency"
+)
+
+// Defaults used when the config leaves them empty
+const (
+	DefaultWindow         = 30 * 24 * time.Hour
+	DefaultReportInterval = 30 * time.Second
+)
+
+// BurnRateWindows are the short windows the burn rate is reported for, on top of the full window
+var BurnRateWindows = []time.Duration{time.Hour, 6 * time.Hour}
+
+// Objective describes the SLIs tracked for one route.
+// A zero target disables the matching SLI.
+type Objective struct {
+	Name               string
+	Route              string
+	AvailabilityTarget float64 // ratio, e.g. 0.999
+	LatencyTarget      float64 // ratio of requests under LatencyThreshold, e.g. 0.99
+	LatencyThreshold   time.Duration
+	Window             time.Duration
+}
+
+// Options holds the tracker settings
+type Options struct {
+	Objectives     []Objective
+	ReportInterval time.Duration
+}
+
+// Tracker computes rolling SLIs from request outcomes and reports burn rates
+type Tracker struct {
+	metric   metric.MetricInterface
+	interval time.Duration
+	routes   map[string][]*tracked
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+type tracked struct {
+	objective Objective
+	events    *ring
+}
+
+// New init new slo tracker
+func New(m metric.MetricInterface, o *Options) *Tracker {
+	interval := o.ReportInterval
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	t := &Tracker{
+		metric:   m,
+		interval: interval,
+		routes:   map[string][]*tracked{},
+		stop:     make(chan struct{}),
+	}
+	for _, obj := range o.Objectives {
+		if obj.Window <= 0 {
+			obj.Window = DefaultWindow
+		}
+		t.routes[obj.Route] = append(t.routes[obj.Route], &tracked{
+			objective: obj,
+			events:    newRing(obj.Window),
+		})
+	}
+	return t
+}
+
+// NewFromConfig init new slo tracker from the [SLO "name"] config sections
+func NewFromConfig(m metric.MetricInterface, cfg map[string]*config.SLOConfig) *Tracker {
+	o := &Options{}
+	for name, c := range cfg {
+		o.Objectives = append(o.Objectives, Objective{
+			Name:               name,
+			Route:              c.Route,
+			AvailabilityTarget: c.Availability / 100,
+			LatencyTarget:      c.Latency / 100,
+			LatencyThreshold:   time.Duration(c.LatencyThreshold) * time.Millisecond,
+			Window:             time.Duration(c.Window) * 24 * time.Hour,
+		})
+	}
+	return New(m, o)
+}
+
+// Observe records a request outcome, it is meant to be registered as a router observer
+func (t *Tracker) Observe(route string, code int, latency time.Duration) {
+	for _, tr := range t.routes[route] {
+		unavailable := code >= http.StatusInternalServerError
+		slow := tr.objective.LatencyThreshold > 0 && latency > tr.objective.LatencyThreshold
+		tr.events.add(time.Now(), unavailable, slow)
+	}
+}
+
+// Start reports the burn rates in background until Stop is called
+func (t *Tracker) Start() {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.report()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops reporting
+func (t *Tracker) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+	t.wg.Wait()
+}
+
+func (t *Tracker) report() {
+	for _, s := range t.Status() {
+		for _, sli := range s.SLIs {
+			tags := []string{"slo:" + s.Name, "sli:" + sli.Kind, "url_path:" + s.Route}
+			t.gauge("slo.sli", sli.Value, tags)
+			t.gauge("slo.error_budget_remaining", sli.BudgetRemaining, tags)
+			for window, burnRate := range sli.BurnRates {
+				t.gauge("slo.burn_rate", burnRate, append(tags, "window:"+window))
+			}
+		}
+	}
+}
+
+func (t *Tracker) gauge(name string, value float64, tags []string) {
+	if err := t.metric.Gauge(name, value, tags, 1); err != nil {
+		log.Println("failed to submit slo metric", name, err)
+	}
+}
@@ -0,0 +1,241 @@
+package slo
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ariefaprilianto/ddog-experimental/infrastructure/metric/definitions/metrictest"
+)
+
+func TestRingSum(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	r := newRing(time.Hour)
+	if r.width != time.Second {
+		t.Fatalf("width = %s, want 1s for a 1h window", r.width)
+	}
+	// out of the window, its bucket is reused by now
+	r.add(now.Add(-time.Hour-time.Second), true, false)
+	r.add(now.Add(-30*time.Minute), true, true)
+	r.add(now.Add(-10*time.Minute), false, true)
+	r.add(now.Add(-time.Second), false, false)
+	r.add(now, false, false)
+	r.add(now, true, false)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		d    time.Duration
+		want counts
+	}{
+		{"full window", now, time.Hour, counts{total: 5, unavailable: 2, slow: 2}},
+		{"last 15 minutes", now, 15 * time.Minute, counts{total: 4, unavailable: 1, slow: 1}},
+		{"last second", now, time.Second, counts{total: 2, unavailable: 1}},
+		{"later", now.Add(20 * time.Minute), time.Hour, counts{total: 5, unavailable: 2, slow: 2}},
+		{"window passed", now.Add(time.Hour), time.Hour, counts{}},
+		{"before the events", now.Add(-time.Hour), 10 * time.Minute, counts{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.sum(tt.at, tt.d); got != tt.want {
+				t.Errorf("sum() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRingBoundsBuckets(t *testing.T) {
+	r := newRing(DefaultWindow)
+	if len(r.buckets) > maxBuckets+1 {
+		t.Errorf("buckets = %d, want at most %d", len(r.buckets), maxBuckets+1)
+	}
+}
+
+func TestBurnRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		target float64
+		total  int64
+		bad    int64
+		want   float64
+	}{
+		{"no traffic", 0.999, 0, 0, 0},
+		{"no error", 0.999, 1000, 0, 0},
+		{"budget pace", 0.999, 1000, 1, 1},
+		{"ten times the pace", 0.99, 100, 10, 10},
+		{"all bad", 0.9, 10, 10, 10},
+		{"perfect target", 1, 100, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := burnRate(tt.target, tt.total, tt.bad); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("burnRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSLIStatus(t *testing.T) {
+	obj := Objective{AvailabilityTarget: 0.99, LatencyTarget: 0.9, LatencyThreshold: time.Second, Window: 24 * time.Hour}
+	tests := []struct {
+		name                string
+		kind                string
+		full                counts
+		short               map[string]counts
+		wantValue           float64
+		wantBudgetRemaining float64
+		wantBurnRates       map[string]float64
+	}{
+		{
+			name:                "no traffic",
+			kind:                SLIAvailability,
+			wantValue:           1,
+			wantBudgetRemaining: 1,
+			wantBurnRates:       map[string]float64{"1d": 0},
+		},
+		{
+			name:                "half the availability budget",
+			kind:                SLIAvailability,
+			full:                counts{total: 1000, unavailable: 5, slow: 100},
+			short:               map[string]counts{"1h": {total: 100, unavailable: 2}},
+			wantValue:           0.995,
+			wantBudgetRemaining: 0.5,
+			wantBurnRates:       map[string]float64{"1d": 0.5, "1h": 2},
+		},
+		{
+			name:                "latency counts the slow requests",
+			kind:                SLILatency,
+			full:                counts{total: 1000, unavailable: 5, slow: 100},
+			wantValue:           0.9,
+			wantBudgetRemaining: 0,
+			wantBurnRates:       map[string]float64{"1d": 1},
+		},
+		{
+			name:                "budget exhausted",
+			kind:                SLIAvailability,
+			full:                counts{total: 100, unavailable: 3},
+			wantValue:           0.97,
+			wantBudgetRemaining: -2,
+			wantBurnRates:       map[string]float64{"1d": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := func(c counts) int64 { return c.unavailable }
+			if tt.kind == SLILatency {
+				bad = func(c counts) int64 { return c.slow }
+			}
+			s := sliStatus(tt.kind, obj, tt.full, tt.short, bad)
+			if s.Kind != tt.kind || s.Total != tt.full.total || s.Bad != bad(tt.full) {
+				t.Errorf("sliStatus() = %+v, want %s with the full window counts", s, tt.kind)
+			}
+			if math.Abs(s.Value-tt.wantValue) > 1e-9 {
+				t.Errorf("Value = %v, want %v", s.Value, tt.wantValue)
+			}
+			if math.Abs(s.BudgetRemaining-tt.wantBudgetRemaining) > 1e-9 {
+				t.Errorf("BudgetRemaining = %v, want %v", s.BudgetRemaining, tt.wantBudgetRemaining)
+			}
+			if len(s.BurnRates) != len(tt.wantBurnRates) {
+				t.Errorf("BurnRates = %v, want %v", s.BurnRates, tt.wantBurnRates)
+			}
+			for window, want := range tt.wantBurnRates {
+				if got := s.BurnRates[window]; math.Abs(got-want) > 1e-9 {
+					t.Errorf("BurnRates[%s] = %v, want %v", window, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := metrictest.New()
+	tracker := New(m, &Options{Objectives: []Objective{
+		{Name: "accounts", Route: "/accounts", AvailabilityTarget: 0.9, LatencyTarget: 0.5, LatencyThreshold: 100 * time.Millisecond, Window: 2 * time.Hour},
+		{Name: "accounts_available", Route: "/accounts", AvailabilityTarget: 0.99},
+	}})
+
+	observations := []struct {
+		route   string
+		code    int
+		latency time.Duration
+	}{
+		{"/accounts", http.StatusOK, 50 * time.Millisecond},
+		{"/accounts", http.StatusOK, 100 * time.Millisecond},
+		// the threshold is exclusive
+		{"/accounts", http.StatusOK, 101 * time.Millisecond},
+		{"/accounts", http.StatusBadRequest, 10 * time.Millisecond},
+		{"/accounts", http.StatusServiceUnavailable, 200 * time.Millisecond},
+		{"/customers", http.StatusInternalServerError, time.Second},
+	}
+	for _, o := range observations {
+		tracker.Observe(o.route, o.code, o.latency)
+	}
+
+	statuses := tracker.Status()
+	if len(statuses) != 2 || statuses[0].Name != "accounts" || statuses[1].Name != "accounts_available" {
+		t.Fatalf("Status() = %+v, want accounts then accounts_available", statuses)
+	}
+	if statuses[0].Window != "2h" || statuses[1].Window != "30d" {
+		t.Errorf("windows = %s and %s, want 2h and the 30d default", statuses[0].Window, statuses[1].Window)
+	}
+
+	tests := []struct {
+		name     string
+		status   Status
+		kind     string
+		wantBad  int64
+		wantRate []string
+	}{
+		{"availability counts the 5xx", statuses[0], SLIAvailability, 1, []string{"2h", "1h"}},
+		{"latency counts over the threshold", statuses[0], SLILatency, 2, []string{"2h", "1h"}},
+		{"objective without latency target", statuses[1], SLIAvailability, 1, []string{"30d", "1h", "6h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sli *SLIStatus
+			for i := range tt.status.SLIs {
+				if tt.status.SLIs[i].Kind == tt.kind {
+					sli = &tt.status.SLIs[i]
+				}
+			}
+			if sli == nil {
+				t.Fatalf("SLIs = %+v, want a %s SLI", tt.status.SLIs, tt.kind)
+			}
+			if sli.Total != 5 || sli.Bad != tt.wantBad {
+				t.Errorf("Total = %d, Bad = %d, want 5 and %d", sli.Total, sli.Bad, tt.wantBad)
+			}
+			if len(sli.BurnRates) != len(tt.wantRate) {
+				t.Errorf("BurnRates = %v, want the windows %v", sli.BurnRates, tt.wantRate)
+			}
+			for _, window := range tt.wantRate {
+				if _, ok := sli.BurnRates[window]; !ok {
+					t.Errorf("BurnRates = %v, want the %s window", sli.BurnRates, window)
+				}
+			}
+		})
+	}
+	if len(statuses[1].SLIs) != 1 {
+		t.Errorf("SLIs = %+v, want the availability only", statuses[1].SLIs)
+	}
+
+	tracker.report()
+	if p, ok := m.Last("slo.burn_rate", "slo:accounts", "sli:latency", "url_path:/accounts", "window:2h"); !ok || math.Abs(p.Value-0.8) > 1e-9 {
+		t.Errorf("slo.burn_rate = %+v, want 0.8 for the latency over 2h", p)
+	}
+	if p, ok := m.Last("slo.sli", "slo:accounts", "sli:availability"); !ok || math.Abs(p.Value-0.8) > 1e-9 {
+		t.Errorf("slo.sli = %+v, want 0.8 for the availability", p)
+	}
+}
+
+func TestWindowName(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		30 * 24 * time.Hour: "30d",
+		6 * time.Hour:       "6h",
+		90 * time.Minute:    "1h30m0s",
+	} {
+		if got := windowName(d); got != want {
+			t.Errorf("windowName(%s) = %s, want %s", d, got, want)
+		}
+	}
+}
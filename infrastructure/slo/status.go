@@ -0,0 +1,125 @@
+package slo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Status is the current state of an objective
+type Status struct {
+	Name   string      `json:"name"`
+	Route  string      `json:"route"`
+	Window string      `json:"window"`
+	SLIs   []SLIStatus `json:"slis"`
+}
+
+// SLIStatus is the current state of one SLI over the objective window
+type SLIStatus struct {
+	Kind            string             `json:"kind"`
+	Target          float64            `json:"target"`
+	Value           float64            `json:"value"`
+	Total           int64              `json:"total"`
+	Bad             int64              `json:"bad"`
+	BudgetRemaining float64            `json:"budget_remaining"`
+	BurnRates       map[string]float64 `json:"burn_rates"`
+}
+
+// Status returns the state of every objective, sorted by name
+func (t *Tracker) Status() []Status {
+	now := time.Now()
+	statuses := []Status{}
+	for _, trs := range t.routes {
+		for _, tr := range trs {
+			statuses = append(statuses, tr.status(now))
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func (tr *tracked) status(now time.Time) Status {
+	obj := tr.objective
+	s := Status{
+		Name:   obj.Name,
+		Route:  obj.Route,
+		Window: windowName(obj.Window),
+		SLIs:   []SLIStatus{},
+	}
+
+	full := tr.events.sum(now, obj.Window)
+	short := map[string]counts{}
+	for _, w := range BurnRateWindows {
+		if w < obj.Window {
+			short[windowName(w)] = tr.events.sum(now, w)
+		}
+	}
+
+	if obj.AvailabilityTarget > 0 {
+		s.SLIs = append(s.SLIs, sliStatus(SLIAvailability, obj, full, short, func(c counts) int64 {
+			return c.unavailable
+		}))
+	}
+	if obj.LatencyTarget > 0 && obj.LatencyThreshold > 0 {
+		s.SLIs = append(s.SLIs, sliStatus(SLILatency, obj, full, short, func(c counts) int64 {
+			return c.slow
+		}))
+	}
+	return s
+}
+
+func sliStatus(kind string, obj Objective, full counts, short map[string]counts, bad func(counts) int64) SLIStatus {
+	target := obj.AvailabilityTarget
+	if kind == SLILatency {
+		target = obj.LatencyTarget
+	}
+
+	s := SLIStatus{
+		Kind:            kind,
+		Target:          target,
+		Value:           1,
+		Total:           full.total,
+		Bad:             bad(full),
+		BudgetRemaining: 1,
+		BurnRates:       map[string]float64{},
+	}
+
+	s.BurnRates[windowName(obj.Window)] = burnRate(target, full.total, bad(full))
+	for name, c := range short {
+		s.BurnRates[name] = burnRate(target, c.total, bad(c))
+	}
+
+	if full.total > 0 {
+		s.Value = 1 - float64(s.Bad)/float64(full.total)
+		// allowed bad events over the window so far
+		budget := (1 - target) * float64(full.total)
+		if budget > 0 {
+			s.BudgetRemaining = 1 - float64(s.Bad)/budget
+		} else if s.Bad > 0 {
+			s.BudgetRemaining = 0
+		}
+	}
+	return s
+}
+
+// burnRate is the observed error rate divided by the error rate allowed by the target.
+// A burn rate of 1 consumes exactly the whole budget over the window.
+func burnRate(target float64, total, bad int64) float64 {
+	if total == 0 || target >= 1 {
+		return 0
+	}
+	return (float64(bad) / float64(total)) / (1 - target)
+}
+
+// windowName formats a window as used in tags, e.g. 1h or 30d
+func windowName(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
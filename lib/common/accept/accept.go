@@ -0,0 +1,50 @@
+// Package accept parses the content negotiation headers, e.g. Accept and Accept-Encoding
+package accept
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Value is an entry of a negotiation header with its quality
+type Value struct {
+	// Name is the lowercased media type or encoding, e.g. application/json or gzip
+	Name string
+	Q    float64
+}
+
+// Parse returns the entries of header in order, their quality is 1 unless set by the q param
+func Parse(header string) []Value {
+	values := []Value{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		values = append(values, Value{Name: name, Q: q})
+	}
+	return values
+}
+
+// Quality returns the highest quality given to any of names, false when none of them is listed
+func Quality(values []Value, names ...string) (float64, bool) {
+	q, found := 0.0, false
+	for _, v := range values {
+		for _, name := range names {
+			if v.Name == strings.ToLower(name) && (!found || v.Q > q) {
+				q, found = v.Q, true
+			}
+		}
+	}
+	return q, found
+}
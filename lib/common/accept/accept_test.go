@@ -0,0 +1,52 @@
+package accept
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []Value
+	}{
+		{"", []Value{}},
+		{"gzip", []Value{{"gzip", 1}}},
+		{"Application/JSON, */*;q=0.8", []Value{{"application/json", 1}, {"*/*", 0.8}}},
+		{"br;q=1.0, gzip; q=0.5 ,identity;q=0", []Value{{"br", 1}, {"gzip", 0.5}, {"identity", 0}}},
+		{"text/html;level=1;q=0.7", []Value{{"text/html", 0.7}}},
+		// an invalid quality is ignored like a missing one
+		{"gzip;q=high", []Value{{"gzip", 1}}},
+		{" , gzip,", []Value{{"gzip", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := Parse(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuality(t *testing.T) {
+	values := Parse("application/msgpack;q=0.5, application/x-msgpack;q=0.9, */*;q=0")
+	tests := []struct {
+		name      string
+		names     []string
+		wantQ     float64
+		wantFound bool
+	}{
+		{"highest of the names", []string{"application/msgpack", "application/x-msgpack"}, 0.9, true},
+		{"case insensitive", []string{"Application/MsgPack"}, 0.5, true},
+		{"zero quality is listed", []string{"*/*"}, 0, true},
+		{"not listed", []string{"application/json"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, found := Quality(values, tt.names...)
+			if q != tt.wantQ || found != tt.wantFound {
+				t.Errorf("Quality(%v) = %v, %v, want %v, %v", tt.names, q, found, tt.wantQ, tt.wantFound)
+			}
+		})
+	}
+}
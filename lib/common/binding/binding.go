@@ -0,0 +1,193 @@
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/err"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/validate"
+)
+
+// DefaultMaxBodySize is used when Options.MaxBodySize is not positive
+const DefaultMaxBodySize = 1 << 20
+
+// Error names of the body level failures, the field failures are named after the field
+const (
+	ErrorInvalidBody            = "invalid_body"
+	ErrorBodyTooLarge           = "body_too_large"
+	ErrorUnsupportedContentType = "unsupported_content_type"
+)
+
+// Options holds the binding settings
+type Options struct {
+	// MaxBodySize is the body size limit in bytes
+	MaxBodySize int64
+	// DisallowUnknownFields rejects the json bodies holding fields dst does not have
+	DisallowUnknownFields bool
+}
+
+// Binder decodes and validates request bodies
+type Binder struct {
+	opt       Options
+	validator *validate.Validator
+}
+
+var defaultBinder = New(&Options{})
+
+// New init new binder, the invalid fields are reported with their json name, else their form name
+func New(o *Options) *Binder {
+	b := &Binder{opt: *o, validator: validate.New()}
+	if b.opt.MaxBodySize <= 0 {
+		b.opt.MaxBodySize = DefaultMaxBodySize
+	}
+	b.validator.FieldName = fieldName
+	return b
+}
+
+// Bind decodes the body of r into dst with the default binder
+func Bind(r *http.Request, dst interface{}) error {
+	return defaultBinder.Bind(r, dst)
+}
+
+// Bind decodes the json or form body of r into dst, a pointer to struct, by its
+// Content-Type then validates dst with its validate tags. It returns an
+// *err.ErrorMessage with the 400 code and an ErrorFormat per failure, see
+// response.JSONResponse.SetErrorMessage.
+func (b *Binder) Bind(r *http.Request, dst interface{}) error {
+	if r.Body == nil {
+		return err.SetNewBadRequest(ErrorInvalidBody, "body is required")
+	}
+	body := &limitedReader{r: r.Body, n: b.opt.MaxBodySize}
+	r.Body = readCloser{Reader: body, Closer: r.Body}
+
+	contentType, _, e := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if e != nil && r.Header.Get("Content-Type") != "" {
+		return err.SetNewBadRequest(ErrorUnsupportedContentType, "invalid Content-Type")
+	}
+
+	switch contentType {
+	case "", "application/json":
+		e = b.decodeJSON(r.Body, dst)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		e = b.decodeForm(r, dst)
+	default:
+		return err.SetNewBadRequest(ErrorUnsupportedContentType, fmt.Sprintf("%s is not supported, use application/json or a form", contentType))
+	}
+	if body.exceeded {
+		return err.SetNewBadRequest(ErrorBodyTooLarge, fmt.Sprintf("body must be at most %d bytes", b.opt.MaxBodySize))
+	}
+	if e != nil {
+		return e
+	}
+
+	return b.Validate(dst)
+}
+
+// Validate validates dst with its validate tags, the failures are returned like Bind does
+func (b *Binder) Validate(dst interface{}) error {
+	e := b.validator.Struct(dst)
+	if e == nil {
+		return nil
+	}
+	fieldErrs, ok := e.(validate.Errors)
+	if !ok {
+		return err.SetNewBadRequest(ErrorInvalidBody, e.Error())
+	}
+	em := err.NewErrorMessage().SetBadRequest()
+	for _, fe := range fieldErrs {
+		em.Append(fe.Field, fe.Message)
+	}
+	return em
+}
+
+func (b *Binder) decodeJSON(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
+	if b.opt.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	e := dec.Decode(dst)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case e == nil:
+	case errors.Is(e, io.EOF):
+		return err.SetNewBadRequest(ErrorInvalidBody, "body is required")
+	case errors.As(e, &typeErr) && typeErr.Field != "":
+		return err.SetNewBadRequest(typeErr.Field, "must be a "+typeErr.Type.String())
+	default:
+		return err.SetNewBadRequest(ErrorInvalidBody, strings.TrimPrefix(e.Error(), "json: "))
+	}
+
+	if dec.More() {
+		return err.SetNewBadRequest(ErrorInvalidBody, "body must hold a single json value")
+	}
+	return nil
+}
+
+func (b *Binder) decodeForm(r *http.Request, dst interface{}) error {
+	var e error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		e = r.ParseMultipartForm(b.opt.MaxBodySize)
+	} else {
+		e = r.ParseForm()
+	}
+	if e != nil {
+		return err.SetNewBadRequest(ErrorInvalidBody, e.Error())
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binding: dst must be a pointer to struct, got %T", dst)
+	}
+	em := err.NewErrorMessage().SetBadRequest()
+	decodeValues(r.PostForm, v.Elem(), em)
+	if len(em.ErrorList) > 0 {
+		return em
+	}
+	return nil
+}
+
+// fieldName returns the json name of f, or its form name, or its go name
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// limitedReader reads up to n bytes and records whether the body held more
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// one more byte tells an exact size body from a larger one
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			l.exceeded = true
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, e := l.r.Read(p)
+	l.n -= int64(n)
+	return n, e
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
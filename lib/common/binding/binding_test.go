@@ -0,0 +1,201 @@
+package binding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/err"
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/response"
+)
+
+type account struct {
+	Name  string   `json:"name" form:"name" validate:"required"`
+	Age   int      `json:"age" form:"age" validate:"min=18"`
+	Tags  []string `json:"tags,omitempty" form:"tag"`
+	Admin *bool    `json:"admin,omitempty" form:"admin"`
+}
+
+// errorNames returns the error names of e, an *err.ErrorMessage with the 400 code
+func errorNames(t *testing.T, e error) []string {
+	t.Helper()
+	em, ok := e.(*err.ErrorMessage)
+	if !ok {
+		t.Fatalf("error = %T %v, want an *err.ErrorMessage", e, e)
+	}
+	if em.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want %d", em.Code, http.StatusBadRequest)
+	}
+	names := []string{}
+	for _, ef := range em.ErrorList {
+		names = append(names, ef.ErrorName)
+	}
+	return names
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		// wantErrors are the error names reported, in order
+		wantErrors []string
+	}{
+		{"json", "application/json", `{"name":"alice","age":20}`, nil},
+		{"json without content type", "", `{"name":"alice","age":20}`, nil},
+		{"json with charset", "application/json; charset=utf-8", `{"name":"alice","age":20}`, nil},
+		{"empty body", "application/json", "", []string{ErrorInvalidBody}},
+		{"malformed json", "application/json", `{"name":`, []string{ErrorInvalidBody}},
+		{"type error names the field", "application/json", `{"name":"alice","age":"twenty"}`, []string{"age"}},
+		{"multiple json values", "application/json", `{"name":"alice","age":20} {}`, []string{ErrorInvalidBody}},
+		{"unknown fields are allowed", "application/json", `{"name":"alice","age":20,"other":1}`, nil},
+		{"unsupported content type", "text/plain", "name=alice", []string{ErrorUnsupportedContentType}},
+		{"invalid content type", "application/", `{}`, []string{ErrorUnsupportedContentType}},
+		{"validation reports json names", "application/json", `{"age":12}`, []string{"name", "age"}},
+		{"form", "application/x-www-form-urlencoded", "name=alice&age=20&tag=a&tag=b&admin=true", nil},
+		{"form type error", "application/x-www-form-urlencoded", "name=alice&age=twenty&admin=maybe", []string{"age", "admin"}},
+		{"form validation", "application/x-www-form-urlencoded", "age=20", []string{"name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			var dst account
+			e := Bind(r, &dst)
+			if tt.wantErrors == nil {
+				if e != nil {
+					t.Fatalf("Bind() error = %v", e)
+				}
+				if dst.Name != "alice" || dst.Age != 20 {
+					t.Errorf("Bind() = %+v, want alice of 20", dst)
+				}
+				return
+			}
+			if e == nil {
+				t.Fatalf("Bind() = %+v, want errors %v", dst, tt.wantErrors)
+			}
+			if got := errorNames(t, e); strings.Join(got, ",") != strings.Join(tt.wantErrors, ",") {
+				t.Errorf("Bind() errors = %v, want %v", got, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader("name=alice&age=20&tag=a&tag=b&admin=true"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var dst account
+	if e := Bind(r, &dst); e != nil {
+		t.Fatalf("Bind() error = %v", e)
+	}
+	if strings.Join(dst.Tags, ",") != "a,b" || dst.Admin == nil || !*dst.Admin {
+		t.Errorf("Bind() = %+v, want the tags a and b and admin", dst)
+	}
+}
+
+func TestBindWithoutBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/accounts", nil)
+	r.Body = nil
+
+	e := Bind(r, &account{})
+	if got := errorNames(t, e); len(got) != 1 || got[0] != ErrorInvalidBody {
+		t.Errorf("Bind() errors = %v, want %s", got, ErrorInvalidBody)
+	}
+}
+
+func TestBindDisallowUnknownFields(t *testing.T) {
+	b := New(&Options{DisallowUnknownFields: true})
+	r := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"name":"alice","age":20,"other":1}`))
+
+	e := b.Bind(r, &account{})
+	if got := errorNames(t, e); len(got) != 1 || got[0] != ErrorInvalidBody {
+		t.Errorf("Bind() errors = %v, want %s", got, ErrorInvalidBody)
+	}
+}
+
+func TestBindMaxBodySize(t *testing.T) {
+	body := `{"name":"alice","age":20}`
+	size := int64(len(body))
+	tests := []struct {
+		name        string
+		maxBodySize int64
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{"exact size", size, "application/json", body, ""},
+		{"one byte over", size - 1, "application/json", body, ErrorBodyTooLarge},
+		// the limit holds even when the decoder stops before the end
+		{"trailing bytes over", size, "application/json", body + " ", ErrorBodyTooLarge},
+		{"form over", 8, "application/x-www-form-urlencoded", "name=alice&age=20", ErrorBodyTooLarge},
+		{"default limit", 0, "application/json", `{"name":"alice","age":20,"tags":["` + strings.Repeat("a", DefaultMaxBodySize) + `"]}`, ErrorBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(&Options{MaxBodySize: tt.maxBodySize})
+			r := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			e := b.Bind(r, &account{})
+			if tt.wantErr == "" {
+				if e != nil {
+					t.Errorf("Bind() error = %v", e)
+				}
+				return
+			}
+			if got := errorNames(t, e); len(got) != 1 || got[0] != tt.wantErr {
+				t.Errorf("Bind() errors = %v, want %s", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewDefaultMaxBodySize(t *testing.T) {
+	for _, size := range []int64{0, -1} {
+		if b := New(&Options{MaxBodySize: size}); b.opt.MaxBodySize != DefaultMaxBodySize {
+			t.Errorf("New(%d) MaxBodySize = %d, want %d", size, b.opt.MaxBodySize, DefaultMaxBodySize)
+		}
+	}
+}
+
+// TestBindHandler binds the body in a handler the way the api handlers do, the failures
+// are answered as a 400 listing an error per field
+func TestBindHandler(t *testing.T) {
+	b := New(&Options{MaxBodySize: 1024})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req account
+		if e := b.Bind(r, &req); e != nil {
+			response.NewJSONResponse().SetError(e).Render(w, r)
+			return
+		}
+		response.NewJSONResponse().SetData(req).Render(w, r)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"bound", `{"name":"alice","age":20}`, http.StatusOK, `{"code":"200000","data":{"name":"alice","age":20},"latency":""}`},
+		{"invalid", `{"age":12}`, http.StatusBadRequest, `{"code":"400000","error_message":[{"error_name":"name","error_description":"is required"},{"error_name":"age","error_description":"must be at least 18"}],"error":"is required","latency":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
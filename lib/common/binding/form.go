@@ -0,0 +1,103 @@
+package binding
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/err"
+)
+
+// decodeValues sets the fields of v from values, by their form name, then json name,
+// then go name. Strings, bools, numbers, their pointers and slices are supported, a
+// value not converting to its field type is appended to em.
+func decodeValues(values url.Values, v reflect.Value, em *err.ErrorMessage) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := formName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			decodeValues(values, v.Field(i), em)
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if e := setField(v.Field(i), raw); e != "" {
+			em.Append(name, e)
+		}
+	}
+}
+
+func formName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("form"), ",")[0]; name != "" {
+		return name
+	}
+	return fieldName(f)
+}
+
+// setField converts raw into field and returns why it could not, empty on success
+func setField(field reflect.Value, raw []string) string {
+	switch field.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if e := setScalar(slice.Index(i), s); e != "" {
+				return e
+			}
+		}
+		field.Set(slice)
+		return ""
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if e := setScalar(elem.Elem(), raw[0]); e != "" {
+			return e
+		}
+		field.Set(elem)
+		return ""
+	}
+	return setScalar(field, raw[0])
+}
+
+func setScalar(v reflect.Value, s string) string {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, e := strconv.ParseBool(s)
+		if e != nil {
+			return "must be a boolean"
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, e := strconv.ParseInt(s, 10, v.Type().Bits())
+		if e != nil {
+			return "must be an integer"
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, e := strconv.ParseUint(s, 10, v.Type().Bits())
+		if e != nil {
+			return "must be a positive integer"
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, e := strconv.ParseFloat(s, v.Type().Bits())
+		if e != nil {
+			return "must be a number"
+		}
+		v.SetFloat(n)
+	default:
+		return "is not supported in a form"
+	}
+	return ""
+}
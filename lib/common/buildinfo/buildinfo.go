@@ -0,0 +1,48 @@
+// Package buildinfo holds the build metadata set at link time, e.g.
+//
+//	go build -ldflags "\
+//	  -X github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo.Version=v1.2.0 \
+//	  -X github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo.GitCommit=$(git rev-parse --short HEAD) \
+//	  -X github.com/ariefaprilianto/ddog-experimental/lib/common/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	  ./cmd/http/ddogsvc
+package buildinfo
+
+import "runtime"
+
+// DevVersion is the version of a binary built without ldflags
+const DevVersion = "dev"
+
+// Set by the linker, see the package doc
+var (
+	Version   = DevVersion
+	GitCommit = ""
+	BuildTime = ""
+)
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Tags returns the build info as metric tags, the unknown values are left out.
+// The version is not part of them since the metric client sends it with every metric.
+func (i Info) Tags() []string {
+	tags := []string{"go_version:" + i.GoVersion}
+	if i.GitCommit != "" {
+		tags = append(tags, "git_commit:"+i.GitCommit)
+	}
+	return tags
+}
@@ -1,8 +1,21 @@
+// Package env holds the registry of the environments a service can run in and
+// the one currently selected. Services may register extra environments, e.g.
+//
+//	env.Register("canary", env.Defaults{LogLevel: "info", SampleRate: 1})
+//
+// before the environment is selected.
 package env
 
 import (
-	"net"
+	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/instance"
+	log "github.com/sirupsen/logrus"
 )
 
 // Environment List
@@ -13,30 +26,136 @@ const (
 	EnvProduction  = "production"
 )
 
+// EnvVar is the environment variable selecting the environment
+const EnvVar = "ENTENV"
+
+// Defaults holds the settings used when the config leaves them empty, SampleRate is
+// the default metric sample rate, 1 everywhere so lower rates are opted in by config.
+// DebugEndpoints serves the debug endpoints on the admin listener without Admin.Debug.
+type Defaults struct {
+	LogLevel       string
+	SampleRate     float64
+	DebugEndpoints bool
+}
+
+// Environment is a registered environment
+type Environment struct {
+	Name string
+	Defaults
+}
+
+var (
+	mu       sync.RWMutex
+	selected string
+	registry = map[string]Defaults{
+		EnvDevelopment: {LogLevel: "debug", SampleRate: 1, DebugEndpoints: true},
+		EnvAlpha:       {LogLevel: "debug", SampleRate: 1, DebugEndpoints: true},
+		EnvStaging:     {LogLevel: "info", SampleRate: 1, DebugEndpoints: true},
+		EnvProduction:  {LogLevel: "info", SampleRate: 1, DebugEndpoints: false},
+	}
+	// unknown environments already logged by Current
+	logged = map[string]bool{}
+)
+
+// Register adds or replaces the environment name with its defaults
+func Register(name string, d Defaults) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[name] = d
+}
+
+// Lookup returns the registered environment name
+func Lookup(name string) (Environment, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := registry[name]
+	return Environment{Name: name, Defaults: d}, ok
+}
+
+// Names returns the registered environment names, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set selects the environment, overriding ENTENV. It fails when name is not registered.
+func Set(name string) error {
+	if _, ok := Lookup(name); !ok {
+		return unknown(name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	selected = name
+	return nil
+}
+
+// Validate returns an error when the selected environment, or ENTENV, is not registered
+func Validate() error {
+	name := name()
+	if _, ok := Lookup(name); !ok {
+		return unknown(name)
+	}
+	return nil
+}
+
+// Current returns the environment selected by Set, else by ENTENV, else development.
+// An unknown environment falls back to development with an error logged once, call
+// Validate at startup to fail instead.
+func Current() Environment {
+	name := name()
+	e, ok := Lookup(name)
+	if !ok {
+		if firstFallback(name) {
+			log.Errorln(unknown(name), "- falling back to", EnvDevelopment)
+		}
+		e, _ = Lookup(EnvDevelopment)
+	}
+	return e
+}
+
+func firstFallback(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if logged[name] {
+		return false
+	}
+	logged[name] = true
+	return true
+}
+
 // Get return string of current environment flag
 func Get() string {
-	env := os.Getenv("ENTENV")
+	return Current().Name
+}
 
-	if env != EnvAlpha && env != EnvStaging && env != EnvProduction {
-		env = "development"
+func name() string {
+	mu.RLock()
+	s := selected
+	mu.RUnlock()
+	if s != "" {
+		return s
+	}
+	if s = os.Getenv(EnvVar); s != "" {
+		return s
 	}
+	return EnvDevelopment
+}
 
-	return env
+func unknown(name string) error {
+	return fmt.Errorf("unknown environment %q, registered environments are: %s", name, strings.Join(Names(), ", "))
 }
 
-// GetServerIpAddress is function to get the ip address from instance
+// GetServerIpAddress is function to get the primary ip address from instance, see instance.Detect
 func GetServerIpAddress() (string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
-	}
-	var ip string
-	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				ip += ipnet.IP.String()
-			}
-		}
+	ip := instance.Detect(nil).PrimaryIP
+	if ip == "" {
+		return "", errors.New("no ip address found")
 	}
-	return ip, err
+	return ip, nil
 }
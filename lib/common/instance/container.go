@@ -0,0 +1,42 @@
+package instance
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+)
+
+var (
+	// cgroupPattern matches the 64 hex characters id of docker and containerd containers in a cgroup path
+	cgroupPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+	// mountPattern matches the id in the container files mounted by the runtime, e.g. /containers/<id>/hostname,
+	// other 64 hex ids of mountinfo are image layers
+	mountPattern = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+// containerID reads the container id from the cgroup of the process, falling back to
+// the mount info for cgroup v2 hosts. It returns empty outside a container.
+func containerID() string {
+	if id := findContainerID("/proc/self/cgroup", cgroupPattern); id != "" {
+		return id
+	}
+	return findContainerID("/proc/self/mountinfo", mountPattern)
+}
+
+// findContainerID returns the last submatch, or the match, of the first matching line of fname
+func findContainerID(fname string, pattern *regexp.Regexp) string {
+	/* #nosec G304 */
+	f, err := os.Open(fname)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if m := pattern.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[len(m)-1]
+		}
+	}
+	return ""
+}
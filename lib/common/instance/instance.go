@@ -0,0 +1,124 @@
+// Package instance detects where the service runs, for metric tags and logs
+package instance
+
+import (
+	"net"
+	"os"
+)
+
+// Kubernetes downward API environment variables, e.g.
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+const (
+	EnvPodName      = "POD_NAME"
+	EnvPodNamespace = "POD_NAMESPACE"
+	EnvNodeName     = "NODE_NAME"
+)
+
+// Metadata describes the running instance, empty fields could not be detected
+type Metadata struct {
+	Hostname     string   `json:"hostname"`
+	PrimaryIP    string   `json:"primary_ip"`
+	Addresses    []string `json:"addresses"`
+	ContainerID  string   `json:"container_id,omitempty"`
+	PodName      string   `json:"pod_name,omitempty"`
+	PodNamespace string   `json:"pod_namespace,omitempty"`
+	NodeName     string   `json:"node_name,omitempty"`
+}
+
+// Options holds the detection settings
+type Options struct {
+	// IPPolicy selects the primary ip, PreferPrivate by default
+	IPPolicy IPPolicy
+}
+
+// Detect returns the metadata of the running instance
+func Detect(o *Options) Metadata {
+	policy := PreferPrivate
+	if o != nil && o.IPPolicy != nil {
+		policy = o.IPPolicy
+	}
+
+	m := Metadata{
+		Addresses:    []string{},
+		ContainerID:  containerID(),
+		PodName:      os.Getenv(EnvPodName),
+		PodNamespace: os.Getenv(EnvPodNamespace),
+		NodeName:     os.Getenv(EnvNodeName),
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		m.Hostname = host
+	}
+
+	candidates := []Address{}
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, a := range addrs {
+				if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+					candidates = append(candidates, Address{Interface: iface.Name, IP: ipnet.IP})
+					m.Addresses = append(m.Addresses, ipnet.IP.String())
+				}
+			}
+		}
+	}
+	if ip := policy(candidates); ip != nil {
+		m.PrimaryIP = ip.String()
+	}
+
+	return m
+}
+
+// Tags returns the metadata as datadog tags, skipping what was not detected. The pod name and
+// container id change on every deployment, they are left to InfoTags to keep the cardinality
+// of the metrics low.
+func (m Metadata) Tags() []string {
+	tags := []string{}
+	add := func(key, value string) {
+		if value != "" {
+			tags = append(tags, key+":"+value)
+		}
+	}
+	add("host", m.Hostname)
+	add("kube_namespace", m.PodNamespace)
+	add("kube_node", m.NodeName)
+	return tags
+}
+
+// InfoTags returns the per instance tags meant for a single point, e.g. the build info gauge
+func (m Metadata) InfoTags() []string {
+	tags := []string{}
+	if m.PodName != "" {
+		tags = append(tags, "pod_name:"+m.PodName)
+	}
+	if m.ContainerID != "" {
+		tags = append(tags, "container_id:"+m.ContainerID)
+	}
+	return tags
+}
+
+// Fields returns the metadata as log fields, skipping what was not detected
+func (m Metadata) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	add := func(key, value string) {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	add("Hostname", m.Hostname)
+	add("IP", m.PrimaryIP)
+	add("Container-ID", m.ContainerID)
+	add("Pod-Name", m.PodName)
+	add("Pod-Namespace", m.PodNamespace)
+	add("Node-Name", m.NodeName)
+	return fields
+}
@@ -0,0 +1,111 @@
+package instance
+
+import (
+	"net"
+	"strings"
+)
+
+// Address is an address found on a network interface
+type Address struct {
+	Interface string
+	IP        net.IP
+}
+
+// IPPolicy selects the primary ip among the addresses of the up, non loopback interfaces
+type IPPolicy func(addrs []Address) net.IP
+
+// IP policy names, see PolicyByName
+const (
+	PolicyPrivate = "private"
+	PolicyPublic  = "public"
+	PolicyFirst   = "first"
+)
+
+// PreferPrivate selects the first private IPv4, else the first IPv4, else the first address
+func PreferPrivate(addrs []Address) net.IP {
+	if ip := first(addrs, func(ip net.IP) bool { return isIPv4(ip) && isPrivate(ip) }); ip != nil {
+		return ip
+	}
+	return FirstIPv4(addrs)
+}
+
+// PreferPublic selects the first public IPv4, else the first IPv4, else the first address
+func PreferPublic(addrs []Address) net.IP {
+	if ip := first(addrs, func(ip net.IP) bool { return isIPv4(ip) && !isPrivate(ip) }); ip != nil {
+		return ip
+	}
+	return FirstIPv4(addrs)
+}
+
+// FirstIPv4 selects the first IPv4, else the first address
+func FirstIPv4(addrs []Address) net.IP {
+	if ip := first(addrs, isIPv4); ip != nil {
+		return ip
+	}
+	return first(addrs, func(net.IP) bool { return true })
+}
+
+// PreferInterface selects the first IPv4 of the named interface, else falls back to PreferPrivate
+func PreferInterface(name string) IPPolicy {
+	return func(addrs []Address) net.IP {
+		for _, a := range addrs {
+			if a.Interface == name && isIPv4(a.IP) {
+				return a.IP
+			}
+		}
+		return PreferPrivate(addrs)
+	}
+}
+
+// PolicyByName returns the policy of name, or PreferInterface when iface is set.
+// It returns PreferPrivate for an empty or unknown name.
+func PolicyByName(name, iface string) IPPolicy {
+	if iface != "" {
+		return PreferInterface(iface)
+	}
+	switch strings.ToLower(name) {
+	case PolicyPublic:
+		return PreferPublic
+	case PolicyFirst:
+		return FirstIPv4
+	}
+	return PreferPrivate
+}
+
+func first(addrs []Address, match func(net.IP) bool) net.IP {
+	for _, a := range addrs {
+		if match(a.IP) {
+			return a.IP
+		}
+	}
+	return nil
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+var privateBlocks = []*net.IPNet{
+	mustCIDR("10.0.0.0/8"),
+	mustCIDR("172.16.0.0/12"),
+	mustCIDR("192.168.0.0/16"),
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("fc00::/7"),
+}
+
+func isPrivate(ip net.IP) bool {
+	for _, block := range privateBlocks {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, block, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
@@ -0,0 +1,26 @@
+// Package principal carries the authenticated caller of a request in its context
+package principal
+
+import "context"
+
+type contextKey struct{}
+
+// Principal is the authenticated caller
+type Principal struct {
+	Subject string `json:"subject"`
+	// Method is the authentication method, e.g. apikey, hmac or jwt
+	Method string `json:"method"`
+	// Claims holds the verified token claims with the jwt method
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// NewContext returns a copy of ctx carrying p
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of ctx, false when the request is not authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
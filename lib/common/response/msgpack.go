@@ -0,0 +1,19 @@
+package response
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// marshalMsgpack encodes v as MessagePack. The structs are encoded with their json tags so
+// the keys are the same as for the json responses, the keys of the generic maps are sorted
+// for a stable output, like encoding/json, and the numbers use their smallest format.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf).UseJSONTag(true).SortMapKeys(true).UseCompactEncoding(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
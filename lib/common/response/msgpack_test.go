@@ -0,0 +1,125 @@
+package response
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMarshalMsgpack(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string // hex
+	}{
+		{"nil", nil, "c0"},
+		{"true", true, "c3"},
+		{"false", false, "c2"},
+		{"positive fixint", 127, "7f"},
+		{"negative fixint", -32, "e0"},
+		{"uint8", 128, "cc80"},
+		{"int8", -33, "d0df"},
+		{"uint32", 70000, "ce00011170"},
+		{"int64", -1 << 40, "d3ffffff0000000000"},
+		{"float", 1.5, "cb3ff8000000000000"},
+		{"empty string", "", "a0"},
+		{"fixstr", "abc", "a3616263"},
+		{"str8", strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		{"str16", strings.Repeat("a", 256), "da0100" + strings.Repeat("61", 256)},
+		{"fixarray", []interface{}{1, "a"}, "9201a161"},
+		{"array16", make([]interface{}, 16), "dc0010" + strings.Repeat("c0", 16)},
+		{"fixmap sorted", map[string]interface{}{"b": 2, "a": 1}, "82a16101a16202"},
+		{"json tags", struct {
+			Name    string `json:"name"`
+			Skipped string `json:"-"`
+			Empty   string `json:"empty,omitempty"`
+		}{Name: "x", Skipped: "y"}, "81a46e616d65a178"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalMsgpack(tt.v)
+			if err != nil {
+				t.Fatalf("marshalMsgpack() error = %v", err)
+			}
+			if got := hex.EncodeToString(b); got != tt.want {
+				t.Errorf("marshalMsgpack() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalMsgpackMap16(t *testing.T) {
+	m := map[string]interface{}{}
+	for _, k := range "abcdefghijklmnop" {
+		m[string(k)] = 0
+	}
+	b, err := marshalMsgpack(m)
+	if err != nil {
+		t.Fatalf("marshalMsgpack() error = %v", err)
+	}
+	if !bytes.HasPrefix(b, []byte{0xde, 0x00, 0x10, 0xa1, 'a', 0x00}) {
+		t.Errorf("marshalMsgpack() = %x, want a map16 of 16 sorted entries", b)
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"application/msgpack", ContentTypeMsgpack},
+		{"application/x-msgpack", ContentTypeMsgpack},
+		{"Application/MsgPack", ContentTypeMsgpack},
+		{"application/msgpack, application/json", ContentTypeJSON},
+		{"application/msgpack, */*;q=0.8", ContentTypeMsgpack},
+		{"application/msgpack;q=0.5, application/json;q=0.9", ContentTypeJSON},
+		{"application/msgpack;q=0.9, application/json;q=0.5", ContentTypeMsgpack},
+		{"application/msgpack;q=0", ContentTypeJSON},
+		{"text/html", ContentTypeJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiateContentType(tt.accept); got != tt.want {
+				t.Errorf("negotiateContentType(%q) = %s, want %s", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{"json", "/", "", ContentTypeJSON, `{"code":"200000","data":"ok","latency":""}`},
+		{"pretty json", "/?pretty=true", "", ContentTypeJSON, "{\n  \"code\": \"200000\",\n  \"data\": \"ok\",\n  \"latency\": \"\"\n}"},
+		{"msgpack", "/", ContentTypeMsgpack, ContentTypeMsgpack, "\x83\xa4code\xa6200000\xa4data\xa2ok\xa7latency\xa0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			NewJSONResponse().SetData("ok").Render(w, req)
+
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %s, want %s", got, tt.wantContentType)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %s, want Accept", got)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/ariefaprilianto/ddog-experimental/lib/common/accept"
 	"github.com/ariefaprilianto/ddog-experimental/lib/common/custerr"
 	"github.com/ariefaprilianto/ddog-experimental/lib/common/err"
 )
@@ -42,6 +43,8 @@ var (
 	ErrInvalidToken                = errors.New("Invalid auth token")
 	ErrRequiredToken               = errors.New("Auth token is required")
 	ErrUnauthorized                = errors.New("No Authorization Found")
+	ErrServiceUnavailable          = errors.New("Service unavailable")
+	ErrTooManyRequests             = errors.New("Too many requests")
 )
 
 const (
@@ -52,7 +55,9 @@ const (
 	STATUS_FORBIDDEN                            = "403000"
 	STATUSCODE_NOT_FOUND                        = "404000"
 	STATUSCODE_GENERIC_PRECONDITION_FAILED      = "412000" // todo error code change from 412 to 400 dur to nginx issue
+	STATUSCODE_TOO_MANY_REQUESTS                = "429000"
 	STATUSCODE_INTERNAL_ERROR                   = "500000"
+	STATUSCODE_SERVICE_UNAVAILABLE              = "503000"
 	STATUSCODE_TIMEOUT_ERROR                    = "504000"
 	STATUSCODE_ALREADY_REGISTERED               = "400001"
 	STATUSCODE_TX_ALREADY_DONE                  = "400003"
@@ -119,6 +124,12 @@ func GetErrorCodeStr(err error) string {
 		return STATUSCODE_REQUIRED_TOKEN
 	case ErrUnauthorized:
 		return STATUSCODE_UNAUTHORIZED
+	case ErrSignatureMisMatch:
+		return STATUSCODE_UNAUTHORIZED
+	case ErrServiceUnavailable:
+		return STATUSCODE_SERVICE_UNAVAILABLE
+	case ErrTooManyRequests:
+		return STATUSCODE_TOO_MANY_REQUESTS
 	default:
 		return STATUSCODE_INTERNAL_ERROR
 	}
@@ -188,7 +199,15 @@ func getErrType(err error) error {
 	return err
 }
 
+func asErrorMessage(e error) (*err.ErrorMessage, bool) {
+	em, ok := e.(*err.ErrorMessage)
+	return em, ok
+}
+
 func (r *JSONResponse) SetError(err error, a ...string) *JSONResponse {
+	if em, ok := asErrorMessage(err); ok {
+		return r.SetErrorMessage(em)
+	}
 	err = getErrType(err)
 	r.Error = err
 	r.ErrorString = err.Error()
@@ -203,6 +222,21 @@ func (r *JSONResponse) SetError(err error, a ...string) *JSONResponse {
 	return r
 }
 
+// SetErrorMessage sets the error list of em, with its http code, e.g. the 400 of a binding failure
+func (r *JSONResponse) SetErrorMessage(em *err.ErrorMessage) *JSONResponse {
+	r.Error = em
+	r.ErrorMessage = em.GetListError()
+	r.StatusCode = em.GetCode()
+	if r.StatusCode == 0 {
+		r.StatusCode = http.StatusBadRequest
+	}
+	r.Code = fmt.Sprintf("%d000", r.StatusCode)
+	if len(r.ErrorMessage) > 0 {
+		r.ErrorString = r.ErrorMessage[0].ErrorDescription
+	}
+	return r
+}
+
 func (r *JSONResponse) Send(w http.ResponseWriter) {
 	b, _ := json.Marshal(r)
 
@@ -213,3 +247,53 @@ func (r *JSONResponse) Send(w http.ResponseWriter) {
 		log.Println(err)
 	}
 }
+
+// Content types Render can produce
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeMsgpack = "application/msgpack"
+)
+
+// Render sends the response in the format negotiated with the Accept header of req,
+// json or msgpack, json being indented when the pretty query param is 1 or true
+func (r *JSONResponse) Render(w http.ResponseWriter, req *http.Request) {
+	var b []byte
+	var err error
+	contentType := negotiateContentType(req.Header.Get("Accept"))
+	switch {
+	case contentType == ContentTypeMsgpack:
+		b, err = marshalMsgpack(r)
+	case isPretty(req.URL.Query().Get("pretty")):
+		b, err = json.MarshalIndent(r, "", "  ")
+	default:
+		b, err = json.Marshal(r)
+	}
+	if err != nil {
+		log.Println(err)
+		contentType = ContentTypeJSON
+		b, _ = json.Marshal(r)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(r.StatusCode)
+	if _, err := w.Write(b); err != nil {
+		log.Println(err)
+	}
+}
+
+// negotiateContentType picks msgpack only when it is accepted with a higher quality than json
+func negotiateContentType(header string) string {
+	values := accept.Parse(header)
+	jsonQ, _ := accept.Quality(values, ContentTypeJSON, "application/*", "*/*")
+	msgpackQ, ok := accept.Quality(values, ContentTypeMsgpack, "application/x-msgpack")
+	if ok && msgpackQ > 0 && msgpackQ > jsonQ {
+		return ContentTypeMsgpack
+	}
+	return ContentTypeJSON
+}
+
+func isPretty(v string) bool {
+	pretty, _ := strconv.ParseBool(v)
+	return pretty
+}
@@ -0,0 +1,110 @@
+package validate
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func required(v reflect.Value, param string) string {
+	if isZero(v) {
+		return "is required"
+	}
+	if v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// min checks numbers against their value and strings, slices and maps against their length
+func min(v reflect.Value, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid min parameter %q", param)
+	}
+	n, isLength, ok := measure(v)
+	if !ok {
+		return fmt.Sprintf("min is not supported on %s", v.Kind())
+	}
+	if n < limit {
+		if isLength {
+			return fmt.Sprintf("must have at least %s elements", param)
+		}
+		return fmt.Sprintf("must be at least %s", param)
+	}
+	return ""
+}
+
+// max checks numbers against their value and strings, slices and maps against their length
+func max(v reflect.Value, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid max parameter %q", param)
+	}
+	n, isLength, ok := measure(v)
+	if !ok {
+		return fmt.Sprintf("max is not supported on %s", v.Kind())
+	}
+	if n > limit {
+		if isLength {
+			return fmt.Sprintf("must have at most %s elements", param)
+		}
+		return fmt.Sprintf("must be at most %s", param)
+	}
+	return ""
+}
+
+func measure(v reflect.Value) (float64, bool, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
+
+// oneOf checks a string against space separated allowed values
+func oneOf(v reflect.Value, param string) string {
+	if v.Kind() != reflect.String {
+		return fmt.Sprintf("oneof is not supported on %s", v.Kind())
+	}
+	allowed := strings.Fields(param)
+	for _, a := range allowed {
+		if v.String() == a {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be one of [%s]", strings.Join(allowed, ", "))
+}
+
+// hostPort checks a host:port address, the host may be empty as in ":9000"
+func hostPort(v reflect.Value, param string) string {
+	if v.Kind() != reflect.String {
+		return fmt.Sprintf("hostport is not supported on %s", v.Kind())
+	}
+	_, port, err := net.SplitHostPort(v.String())
+	if err != nil {
+		return "must be a host:port address"
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return "must have a port between 0 and 65535"
+	}
+	return ""
+}
+
+func startsWith(v reflect.Value, param string) string {
+	if v.Kind() != reflect.String {
+		return fmt.Sprintf("startswith is not supported on %s", v.Kind())
+	}
+	if !strings.HasPrefix(v.String(), param) {
+		return fmt.Sprintf("must start with %q", param)
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TagName is the struct tag holding the comma separated rules, e.g. `validate:"required,min=1"`
+const TagName = "validate"
+
+// Rule checks v against param and returns why it is invalid, empty when valid
+type Rule func(v reflect.Value, param string) string
+
+// FieldError describes why a field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Errors holds every invalid field found
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator validates structs using the rules of their tags.
+// Rules other than required are skipped on zero values.
+type Validator struct {
+	rules map[string]Rule
+
+	// FieldName returns the name reported for a field, the go field name by default
+	FieldName func(f reflect.StructField) string
+}
+
+var defaultValidator = New()
+
+// New init new validator with the builtin rules
+func New() *Validator {
+	return &Validator{
+		rules: map[string]Rule{
+			"required":   required,
+			"min":        min,
+			"max":        max,
+			"oneof":      oneOf,
+			"hostport":   hostPort,
+			"startswith": startsWith,
+		},
+		FieldName: func(f reflect.StructField) string {
+			return f.Name
+		},
+	}
+}
+
+// Register adds or replaces the rule with name
+func (v *Validator) Register(name string, rule Rule) {
+	v.rules[name] = rule
+}
+
+// Struct validates s, a struct or pointer to struct, and its nested structs, maps and slices.
+// It returns Errors listing every invalid field, or nil.
+func (v *Validator) Struct(s interface{}) error {
+	errs := Errors{}
+	v.walk(reflect.ValueOf(s), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Struct validates s with the builtin rules
+func Struct(s interface{}) error {
+	return defaultValidator.Struct(s)
+}
+
+func (v *Validator) walk(val reflect.Value, path string, errs *Errors) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := join(path, v.FieldName(field))
+			v.check(val.Field(i), name, field.Tag.Get(TagName), errs)
+			v.walk(val.Field(i), name, errs)
+		}
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			v.walk(val.MapIndex(key), join(path, fmt.Sprint(key.Interface())), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			v.walk(val.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func (v *Validator) check(val reflect.Value, name, tag string, errs *Errors) {
+	if tag == "" || tag == "-" {
+		return
+	}
+	for _, r := range strings.Split(tag, ",") {
+		ruleName, param := r, ""
+		if i := strings.Index(r, "="); i >= 0 {
+			ruleName, param = r[:i], r[i+1:]
+		}
+		if ruleName != "required" && isZero(val) {
+			continue
+		}
+		rule, ok := v.rules[ruleName]
+		if !ok {
+			*errs = append(*errs, FieldError{Field: name, Rule: ruleName, Message: "unknown validation rule " + ruleName})
+			continue
+		}
+		if msg := rule(val, param); msg != "" {
+			*errs = append(*errs, FieldError{Field: name, Rule: ruleName, Message: msg})
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}